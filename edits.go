@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/CookieBorn/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+// putChirp lets the author replace a chirp's body while the edit window is
+// open. The new body goes through the same checks as a new chirp, and the
+// old one is kept as a revision.
+func (cfg *ApiConfig) putChirp(res http.ResponseWriter, req *http.Request) error {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		return healpers.MalformedBody(err)
+	}
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	chirpID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	chirp, err := cfg.getChirp(req.Context(), chirpID)
+	if err != nil {
+		return err
+	}
+	if chirp.UserID != usrID {
+		return healpers.Forbidden(healpers.CodeNotAuthor, "Only the author can edit a chirp")
+	}
+	if cfg.Config.ChirpEditWindow <= 0 {
+		return editWindowClosed()
+	}
+	var errs validate.Errors
+	errs.Add("body", validate.ChirpBody(params.Body))
+	if errs.Err() != nil {
+		return healpers.Validation(errs)
+	}
+	verdict := cfg.Filter.Check(params.Body)
+	if verdict.Reject {
+		return healpers.Validation(validate.Errors{"body": "contains banned words"})
+	}
+	// The window is checked by the database against its own clock, the same
+	// one that stamped created_at.
+	oldBody := chirp.Body
+	chirp, err = cfg.DB.EditChirp(req.Context(), database.EditChirpParams{
+		ID:            chirp.ID,
+		WindowSeconds: cfg.Config.ChirpEditWindow.Seconds(),
+		Body:          verdict.Body,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return editWindowClosed()
+	}
+	if healpers.IsUniqueViolation(err) {
+		return healpers.Conflict(healpers.CodeDuplicateChirp, "A chirp with this body already exists")
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("edit chirp: %w", err))
+	}
+	if chirp.Body != oldBody {
+		err = cfg.reindexChirpEntities(req.Context(), chirp)
+		if err != nil {
+			cfg.logger(req).Error("reindex chirp entities failed", "chirp_id", chirp.ID, "error", err)
+		}
+		if verdict.Flag {
+			err = cfg.DB.FlagChirp(req.Context(), database.FlagChirpParams{
+				ChirpID: chirp.ID,
+				Matches: verdict.Matches,
+			})
+		} else {
+			err = cfg.DB.UnflagChirp(req.Context(), chirp.ID)
+		}
+		if err != nil {
+			cfg.logger(req).Error("update chirp flag failed", "chirp_id", chirp.ID, "error", err)
+		}
+	}
+	jsonChirps := healpers.Chirps{healpers.ChirpFromDB(chirp)}
+	err = cfg.decorateChirps(req.Context(), uuid.NullUUID{UUID: usrID, Valid: true}, jsonChirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	healpers.RespondWithJSON(res, req, 200, jsonChirps[0])
+	return nil
+}
+
+func editWindowClosed() *healpers.AppError {
+	return healpers.Forbidden(healpers.CodeEditWindowClosed, "This chirp can no longer be edited")
+}
+
+// getChirpRevisions lists the bodies a chirp had before its edits, newest
+// first.
+func (cfg *ApiConfig) getChirpRevisions(res http.ResponseWriter, req *http.Request) error {
+	chirpID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	_, err = cfg.getChirp(req.Context(), chirpID)
+	if err != nil {
+		return err
+	}
+	revisions, err := cfg.DB.GetChirpRevisions(req.Context(), chirpID)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get chirp revisions: %w", err))
+	}
+	ret := []healpers.ChirpRevision{}
+	for _, revision := range revisions {
+		ret = append(ret, healpers.ChirpRevision{
+			Id:          revision.ID,
+			Body:        revision.Body,
+			Created_at:  revision.CreatedAt,
+			Replaced_at: revision.ReplacedAt,
+		})
+	}
+	healpers.RespondWithJSON(res, req, 200, ret)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+func (cfg *ApiConfig) postFollow(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	followeeID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeUserNotFound, "User not found")
+	}
+	if followeeID == usrID {
+		return healpers.Invalid(healpers.CodeCannotFollowSelf, "Cannot follow yourself")
+	}
+	_, err = cfg.DB.GetUserEmailFromID(req.Context(), followeeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return healpers.NotFound(healpers.CodeUserNotFound, "User not found")
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get user: %w", err))
+	}
+	err = cfg.DB.FollowUser(req.Context(), database.FollowUserParams{
+		FollowerID: usrID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("follow user: %w", err))
+	}
+	res.WriteHeader(204)
+	return nil
+}
+
+func (cfg *ApiConfig) deleteFollow(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	followeeID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeUserNotFound, "User not found")
+	}
+	err = cfg.DB.UnfollowUser(req.Context(), database.UnfollowUserParams{
+		FollowerID: usrID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("unfollow user: %w", err))
+	}
+	res.WriteHeader(204)
+	return nil
+}
+
+func (cfg *ApiConfig) getFollowers(res http.ResponseWriter, req *http.Request) error {
+	usrID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeUserNotFound, "User not found")
+	}
+	page, err := healpers.ParsePageParams(req.URL.Query())
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	rows, err := cfg.DB.GetFollowers(req.Context(), database.GetFollowersParams{
+		UserID:          usrID,
+		CursorCreatedAt: page.CursorCreatedAt(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get followers: %w", err))
+	}
+	users := []healpers.FollowUser{}
+	for _, row := range rows {
+		users = append(users, healpers.FollowUser{
+			Id:            row.ID,
+			Is_chirpy_red: row.IsChirpyRed,
+			Followed_at:   row.FollowedAt,
+		})
+	}
+	healpers.RespondWithJSON(res, req, 200, healpers.NewFollowPage(users, page.Limit))
+	return nil
+}
+
+func (cfg *ApiConfig) getFollowing(res http.ResponseWriter, req *http.Request) error {
+	usrID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeUserNotFound, "User not found")
+	}
+	page, err := healpers.ParsePageParams(req.URL.Query())
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	rows, err := cfg.DB.GetFollowing(req.Context(), database.GetFollowingParams{
+		UserID:          usrID,
+		CursorCreatedAt: page.CursorCreatedAt(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get following: %w", err))
+	}
+	users := []healpers.FollowUser{}
+	for _, row := range rows {
+		users = append(users, healpers.FollowUser{
+			Id:            row.ID,
+			Is_chirpy_red: row.IsChirpyRed,
+			Followed_at:   row.FollowedAt,
+		})
+	}
+	healpers.RespondWithJSON(res, req, 200, healpers.NewFollowPage(users, page.Limit))
+	return nil
+}
+
+// getTimeline returns chirps from everyone the caller follows, newest first.
+func (cfg *ApiConfig) getTimeline(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	page, err := healpers.ParsePageParams(req.URL.Query())
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	chirps, err := cfg.DB.GetTimeline(req.Context(), database.GetTimelineParams{
+		UserID:          usrID,
+		CursorCreatedAt: page.CursorCreatedAt(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get timeline: %w", err))
+	}
+	chirpPage := healpers.NewChirpPage(chirps, page.Limit)
+	err = cfg.decorateChirps(req.Context(), uuid.NullUUID{UUID: usrID, Valid: true}, chirpPage.Chirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	healpers.RespondWithJSON(res, req, 200, chirpPage)
+	return nil
+}
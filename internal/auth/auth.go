@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -14,11 +15,26 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrMissingToken is returned when a request carries no credentials at all,
+// as opposed to credentials that fail to validate.
+var ErrMissingToken = errors.New("missing token")
+
+// Access token validation failures. ParseJWT wraps the underlying jwt error
+// in exactly one of these.
+var (
+	ErrTokenExpired   = errors.New("token expired")
+	ErrTokenMalformed = errors.New("malformed token")
+	ErrTokenSignature = errors.New("invalid token signature")
+	ErrTokenClaims    = errors.New("invalid token claims")
+	// ErrSessionRevoked means the token's signature and claims are fine but
+	// the login session it belongs to has been logged out.
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
 func HashPassword(password string) (string, error) {
 	bytes := []byte(password)
 	pwd, err := bcrypt.GenerateFromPassword(bytes, 10)
 	if err != nil {
-		fmt.Printf("Generate Password error: %v\n", err)
 		return "", err
 	}
 	pwdString := string(pwd)
@@ -26,44 +42,80 @@ func HashPassword(password string) (string, error) {
 }
 
 func CheckPasswordHash(hash, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		fmt.Printf("Check Password Error: %v\n", err)
-		return err
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+const (
+	// Issuer is the iss claim of every token chirpy issues.
+	Issuer = "chirpy"
+	// DefaultAudience is the aud claim unless the KeySet says otherwise.
+	DefaultAudience = "chirpy"
+	// DefaultLeeway is the clock skew tolerated on exp, nbf and iat.
+	DefaultLeeway = 30 * time.Second
+	// AccessTokenUse is the token_use claim of access tokens.
+	AccessTokenUse = "access"
+	// EmailTokenUse is the token_use claim of email verification tokens.
+	EmailTokenUse = "verify_email"
+)
+
+// Claims are the claims carried by chirpy access tokens.
+type Claims struct {
+	jwt.RegisteredClaims
+	// SessionID is the refresh token family the token was issued from.
+	SessionID string `json:"sid,omitempty"`
+	// TokenUse distinguishes access tokens from any other token chirpy
+	// might sign, so one can't be replayed as the other.
+	TokenUse string `json:"token_use"`
+}
+
+// Validate is called by the jwt parser after the registered claims pass.
+func (c Claims) Validate() error {
+	if c.TokenUse != AccessTokenUse {
+		return fmt.Errorf("token_use %q is not %q", c.TokenUse, AccessTokenUse)
+	}
+	if _, err := uuid.Parse(c.Subject); err != nil {
+		return fmt.Errorf("subject: %w", err)
 	}
 	return nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	regClaim := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
+// EmailClaims are the claims carried by email verification tokens.
+type EmailClaims struct {
+	jwt.RegisteredClaims
+	Email    string `json:"email"`
+	TokenUse string `json:"token_use"`
+}
+
+// Validate is called by the jwt parser after the registered claims pass.
+func (c EmailClaims) Validate() error {
+	if c.TokenUse != EmailTokenUse {
+		return fmt.Errorf("token_use %q is not %q", c.TokenUse, EmailTokenUse)
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, regClaim)
-	tString, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		fmt.Printf("Sighned error: %v\n", err)
-		return "", err
+	if _, err := uuid.Parse(c.Subject); err != nil {
+		return fmt.Errorf("subject: %w", err)
 	}
-	return tString, nil
+	if c.Email == "" {
+		return errors.New("missing email")
+	}
+	return nil
+}
+
+// MakeJWT issues an HS256 access token signed with tokenSecret.
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return NewHMACKeySet(tokenSecret).MakeSessionJWT(userID, uuid.Nil, expiresIn)
+}
+
+// ParseJWT verifies an HS256 access token and returns its claims.
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	return NewHMACKeySet(tokenSecret).ParseJWT(tokenString)
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+	claims, err := ParseJWT(tokenString, tokenSecret)
 	if err != nil {
-		fmt.Printf("Parse error: %v\n", err)
 		return uuid.Nil, err
 	}
-	if !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
-	}
-	id := claims.Subject
-	UsrId, err := uuid.Parse(id)
+	UsrId, err := uuid.Parse(claims.Subject)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -74,7 +126,7 @@ func GetBearerToken(headers http.Header) (string, error) {
 	BearerToken := headers.Get("Authorization")
 	splitToken := strings.Split(BearerToken, " ")
 	if len(splitToken) == 1 {
-		return "", errors.New("missing token")
+		return "", ErrMissingToken
 	}
 	return splitToken[1], nil
 }
@@ -89,11 +141,24 @@ func MakeRefreshToken() (string, error) {
 	return randString, nil
 }
 
+// MakeResetToken returns a random single-use token for password reset links.
+func MakeResetToken() (string, error) {
+	return MakeRefreshToken()
+}
+
+// HashToken returns the digest stored in place of a refresh or reset token.
+// Tokens carry 256 bits of randomness, so a plain SHA-256 is enough; there
+// is nothing to brute force.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	BearerToken := headers.Get("Authorization")
 	splitToken := strings.Split(BearerToken, " ")
 	if len(splitToken) < 2 {
-		return "", errors.New("missing token")
+		return "", ErrMissingToken
 	}
 	return splitToken[1], nil
 }
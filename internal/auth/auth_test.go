@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
@@ -109,3 +110,43 @@ func GetBearerTokenTest(t *testing.T) {
 		return
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("Failed to make refresh token: %v", err)
+	}
+	hash := HashToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Errorf("Unexpected digest %q for token %q", hash, token)
+	}
+	if HashToken(token) != hash {
+		t.Errorf("Digest is not deterministic")
+	}
+	// Must agree with the digest the 014 migration computes in Postgres.
+	if got := HashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("HashToken(abc) = %s", got)
+	}
+}
+
+func TestSessionJWT(t *testing.T) {
+	userID, sessionID := uuid.New(), uuid.New()
+	token, err := NewHMACKeySet("secret").MakeSessionJWT(userID, sessionID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	claims, err := ParseJWT(token, "secret")
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	ctx := ContextWithUser(context.Background(), userID, claims)
+	if got, ok := SessionIDFromContext(ctx); !ok || got != sessionID {
+		t.Errorf("SessionIDFromContext = %v, %v; want %v", got, ok, sessionID)
+	}
+
+	token, _ = MakeJWT(userID, "secret", time.Hour)
+	claims, _ = ParseJWT(token, "secret")
+	if _, ok := SessionIDFromContext(ContextWithUser(context.Background(), userID, claims)); ok {
+		t.Errorf("Expected no session ID on a token without sid")
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+type principal struct {
+	userID uuid.UUID
+	claims *Claims
+}
+
+// ContextWithUser returns a copy of ctx carrying the authenticated user and
+// the claims of the token they presented.
+func ContextWithUser(ctx context.Context, userID uuid.UUID, claims *Claims) context.Context {
+	return context.WithValue(ctx, principalKey, principal{userID: userID, claims: claims})
+}
+
+// UserIDFromContext returns the authenticated user's ID, if any.
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	p, ok := ctx.Value(principalKey).(principal)
+	return p.userID, ok
+}
+
+// ClaimsFromContext returns the claims of the request's access token, if any.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	p, ok := ctx.Value(principalKey).(principal)
+	return p.claims, ok
+}
+
+// SessionIDFromContext returns the login session the request's access token
+// was issued for. Tokens minted before sessions existed don't carry one.
+func SessionIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	p, ok := ctx.Value(principalKey).(principal)
+	if !ok || p.claims.SessionID == "" {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(p.claims.SessionID)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,363 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SigningKey is one asymmetric key. Keys loaded from a public key file can
+// only verify.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet signs access tokens with its active key and verifies them with any
+// key it holds, matched by the token's kid header. Rotating keys means
+// adding the new key to the set, letting JWKS consumers pick it up, making
+// it the active key, and dropping the old one once its tokens have expired.
+type KeySet struct {
+	// Audience is written to and required in the aud claim.
+	Audience string
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+	Leeway time.Duration
+	// Logger receives signing and verification diagnostics. Nil discards
+	// them.
+	Logger *slog.Logger
+
+	active *SigningKey
+	keys   map[string]*SigningKey
+	hmac   []byte
+}
+
+// allowedAlgorithms are the only algorithms a KeySet will ever verify,
+// whatever keys it holds.
+var allowedAlgorithms = map[string]bool{
+	jwt.SigningMethodRS256.Alg(): true,
+	jwt.SigningMethodEdDSA.Alg(): true,
+	jwt.SigningMethodHS256.Alg(): true,
+}
+
+// NewKeySet returns a KeySet that signs with keys[0]. With no keys it signs
+// and verifies HS256 with hmacSecret, as chirpy always has. With keys, a
+// non-empty hmacSecret keeps HS256 tokens verifiable as a fallback.
+func NewKeySet(keys []*SigningKey, hmacSecret string) (*KeySet, error) {
+	ks := &KeySet{Audience: DefaultAudience, Leeway: DefaultLeeway, keys: map[string]*SigningKey{}}
+	if hmacSecret != "" {
+		ks.hmac = []byte(hmacSecret)
+	}
+	if len(keys) == 0 {
+		if ks.hmac == nil {
+			return nil, errors.New("no signing keys and no HS256 secret")
+		}
+		return ks, nil
+	}
+	if keys[0].Private == nil {
+		return nil, fmt.Errorf("active key %s has no private key", keys[0].ID)
+	}
+	ks.active = keys[0]
+	for _, k := range keys {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key %s", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// NewHMACKeySet returns a KeySet that only knows HS256 with secret.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		Audience: DefaultAudience,
+		Leeway:   DefaultLeeway,
+		keys:     map[string]*SigningKey{},
+		hmac:     []byte(secret),
+	}
+}
+
+// WithLogger returns a copy of ks that logs to l, typically a logger tagged
+// with the current request.
+func (ks *KeySet) WithLogger(l *slog.Logger) *KeySet {
+	c := *ks
+	c.Logger = l
+	return &c
+}
+
+func (ks *KeySet) log() *slog.Logger {
+	if ks.Logger == nil {
+		return discardLogger
+	}
+	return ks.Logger
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// LoadKeyFile reads a PEM encoded PKCS#8 or PKCS#1 private key, or a PKIX
+// public key. RSA keys sign with RS256 and Ed25519 keys with EdDSA.
+func LoadKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, err := NewSigningKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private or public key. Its ID is
+// the RFC 7638 thumbprint, so the same key always gets the same kid.
+func NewSigningKey(key any) (*SigningKey, error) {
+	k := &SigningKey{}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k.Private, k.Public = key, &key.PublicKey
+	case ed25519.PrivateKey:
+		k.Private, k.Public = key, key.Public()
+	case *rsa.PublicKey, ed25519.PublicKey:
+		k.Public = key
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		k.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	}
+	jwk := k.JWK()
+	// The thumbprint covers only the required members, in lexical order.
+	var canonical string
+	if jwk.Kty == "RSA" {
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	k.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return k, nil
+}
+
+// JWK is the public half of a signing key as published in a JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWK describes the key's public half.
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// JWKS returns the document served at /.well-known/jwks.json. HS256 secrets
+// are never published.
+func (ks *KeySet) JWKS() ([]byte, error) {
+	doc := struct {
+		Keys []JWK `json:"keys"`
+	}{Keys: []JWK{}}
+	if ks.active != nil {
+		doc.Keys = append(doc.Keys, ks.active.JWK())
+	}
+	others := []JWK{}
+	for _, k := range ks.keys {
+		if k != ks.active {
+			others = append(others, k.JWK())
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Kid < others[j].Kid })
+	doc.Keys = append(doc.Keys, others...)
+	return json.Marshal(doc)
+}
+
+// MakeSessionJWT issues an access token tied to a login session so the
+// sessions API can tell which session a request came from.
+func (ks *KeySet) MakeSessionJWT(userID, sessionID uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: ks.registeredClaims(userID, expiresIn),
+		TokenUse:         AccessTokenUse,
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+	return ks.sign(claims)
+}
+
+// MakeEmailJWT issues the token in an email verification link. It proves
+// the user received mail at email, so it only verifies that address.
+func (ks *KeySet) MakeEmailJWT(userID uuid.UUID, email string, expiresIn time.Duration) (string, error) {
+	return ks.sign(EmailClaims{
+		RegisteredClaims: ks.registeredClaims(userID, expiresIn),
+		Email:            email,
+		TokenUse:         EmailTokenUse,
+	})
+}
+
+func (ks *KeySet) registeredClaims(userID uuid.UUID, expiresIn time.Duration) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    Issuer,
+		Audience:  jwt.ClaimStrings{ks.Audience},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		Subject:   userID.String(),
+	}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	var tString string
+	var err error
+	if ks.active != nil {
+		token := jwt.NewWithClaims(ks.active.Method, claims)
+		token.Header["kid"] = ks.active.ID
+		tString, err = token.SignedString(ks.active.Private)
+	} else {
+		tString, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmac)
+	}
+	if err != nil {
+		ks.log().Error("sign JWT failed", "error", err)
+		return "", err
+	}
+	return tString, nil
+}
+
+// ParseJWT verifies an access token and returns its claims. Errors wrap
+// one of ErrTokenExpired, ErrTokenMalformed, ErrTokenSignature or
+// ErrTokenClaims.
+func (ks *KeySet) ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	err := ks.parse(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ParseEmailJWT verifies an email verification token. Errors wrap the same
+// sentinels as ParseJWT.
+func (ks *KeySet) ParseEmailJWT(tokenString string) (*EmailClaims, error) {
+	claims := &EmailClaims{}
+	err := ks.parse(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (ks *KeySet) parse(tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc,
+		jwt.WithValidMethods(ks.methods()),
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(ks.Audience),
+		jwt.WithLeeway(ks.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		ks.log().Debug("parse JWT failed", "error", err)
+		return classifyJWTError(err)
+	}
+	return nil
+}
+
+func classifyJWTError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return fmt.Errorf("%w: %w", ErrTokenMalformed, err)
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return fmt.Errorf("%w: %w", ErrTokenSignature, err)
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return fmt.Errorf("%w: %w", ErrTokenExpired, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrTokenClaims, err)
+	}
+}
+
+func (ks *KeySet) methods() []string {
+	methods := []string{}
+	for _, k := range ks.keys {
+		if allowedAlgorithms[k.Method.Alg()] {
+			methods = append(methods, k.Method.Alg())
+		}
+	}
+	if ks.hmac != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// keyFunc picks the verification key. The key must match the token's alg
+// as well as its kid, so a public key can never be used as an HMAC secret.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		if ks.hmac == nil {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return ks.hmac, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign %s", kid, token.Method.Alg())
+	}
+	return k.Public, nil
+}
@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newEd25519Key(t *testing.T) *SigningKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key, err := NewSigningKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to wrap key: %v", err)
+	}
+	return key
+}
+
+func TestKeySetSignAndVerify(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	rsaKey, err := NewSigningKey(rsaPriv)
+	if err != nil {
+		t.Fatalf("Failed to wrap key: %v", err)
+	}
+	for _, key := range []*SigningKey{rsaKey, newEd25519Key(t)} {
+		ks, err := NewKeySet([]*SigningKey{key}, "")
+		if err != nil {
+			t.Fatalf("NewKeySet: %v", err)
+		}
+		userID := uuid.New()
+		token, err := ks.MakeSessionJWT(userID, uuid.Nil, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to sign with %s: %v", key.Method.Alg(), err)
+		}
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+		if err != nil {
+			t.Fatalf("Failed to decode token: %v", err)
+		}
+		if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != key.Method.Alg() {
+			t.Errorf("Unexpected header %v", parsed.Header)
+		}
+		claims, err := ks.ParseJWT(token)
+		if err != nil {
+			t.Fatalf("Failed to verify %s token: %v", key.Method.Alg(), err)
+		}
+		if claims.Subject != userID.String() {
+			t.Errorf("Subject = %s, want %s", claims.Subject, userID)
+		}
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, newKey := newEd25519Key(t), newEd25519Key(t)
+	before, _ := NewKeySet([]*SigningKey{oldKey}, "")
+	token, err := before.MakeSessionJWT(uuid.New(), uuid.Nil, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	after, err := NewKeySet([]*SigningKey{newKey, oldKey}, "")
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	if _, err := after.ParseJWT(token); err != nil {
+		t.Errorf("Token signed with the previous key should still verify: %v", err)
+	}
+
+	retired, _ := NewKeySet([]*SigningKey{newKey}, "")
+	if _, err := retired.ParseJWT(token); err == nil {
+		t.Errorf("Token signed with a retired key should not verify")
+	}
+}
+
+func TestKeySetHS256Fallback(t *testing.T) {
+	hsToken, err := MakeJWT(uuid.New(), "secret", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	key := newEd25519Key(t)
+
+	withFallback, _ := NewKeySet([]*SigningKey{key}, "secret")
+	if _, err := withFallback.ParseJWT(hsToken); err != nil {
+		t.Errorf("HS256 token should verify with the fallback enabled: %v", err)
+	}
+	withoutFallback, _ := NewKeySet([]*SigningKey{key}, "")
+	if _, err := withoutFallback.ParseJWT(hsToken); err == nil {
+		t.Errorf("HS256 token should be rejected without the fallback")
+	}
+
+	// A token "signed" with HS256 using the public key as the secret must
+	// never verify, even with the fallback on.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: uuid.NewString()})
+	forged.Header["kid"] = key.ID
+	forgedString, _ := forged.SignedString([]byte(key.Public.(ed25519.PublicKey)))
+	if _, err := withFallback.ParseJWT(forgedString); err == nil {
+		t.Errorf("Algorithm confusion token was accepted")
+	}
+}
+
+func TestLoadKeyFileAndJWKS(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	privPath := filepath.Join(t.TempDir(), "signing.pem")
+	err = os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	signing, err := LoadKeyFile(privPath)
+	if err != nil {
+		t.Fatalf("LoadKeyFile: %v", err)
+	}
+
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(otherPriv.Public())
+	pubPath := filepath.Join(t.TempDir(), "verify.pem")
+	os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600)
+	verifyOnly, err := LoadKeyFile(pubPath)
+	if err != nil {
+		t.Fatalf("LoadKeyFile: %v", err)
+	}
+	if _, err := NewKeySet([]*SigningKey{verifyOnly}, ""); err == nil {
+		t.Errorf("A public key can't be the active signing key")
+	}
+
+	ks, err := NewKeySet([]*SigningKey{signing, verifyOnly}, "secret")
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	dat, err := ks.JWKS()
+	if err != nil {
+		t.Fatalf("JWKS: %v", err)
+	}
+	doc := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	if err := json.Unmarshal(dat, &doc); err != nil {
+		t.Fatalf("JWKS is not JSON: %v", err)
+	}
+	if len(doc.Keys) != 2 || doc.Keys[0]["kid"] != signing.ID || doc.Keys[0]["crv"] != "Ed25519" {
+		t.Errorf("Unexpected JWKS: %s", dat)
+	}
+	for _, k := range doc.Keys {
+		if k["d"] != "" || k["k"] != "" {
+			t.Errorf("JWKS leaks secret material: %s", dat)
+		}
+	}
+}
+
+func TestSigningKeyThumbprint(t *testing.T) {
+	// RFC 8037 appendix A.3.
+	pub := ed25519.PublicKey{
+		0xd7, 0x5a, 0x98, 0x01, 0x82, 0xb1, 0x0a, 0xb7, 0xd5, 0x4b, 0xfe, 0xd3, 0xc9, 0x64, 0x07, 0x3a,
+		0x0e, 0xe1, 0x72, 0xf3, 0xda, 0xa6, 0x23, 0x25, 0xaf, 0x02, 0x1a, 0x68, 0xf7, 0x07, 0x51, 0x1a,
+	}
+	key, err := NewSigningKey(pub)
+	if err != nil {
+		t.Fatalf("NewSigningKey: %v", err)
+	}
+	if key.ID != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("Thumbprint = %s", key.ID)
+	}
+}
+
+func signClaims(t *testing.T, claims jwt.Claims, secret string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return token
+}
+
+func TestParseJWTClaimChecks(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	valid := func() Claims {
+		return Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    Issuer,
+				Audience:  jwt.ClaimStrings{DefaultAudience},
+				Subject:   uuid.NewString(),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+			TokenUse: AccessTokenUse,
+		}
+	}
+	if _, err := ks.ParseJWT(signClaims(t, valid(), "secret")); err != nil {
+		t.Fatalf("Valid claims rejected: %v", err)
+	}
+
+	cases := map[string]func(c *Claims){
+		"wrong issuer":    func(c *Claims) { c.Issuer = "someone-else" },
+		"wrong audience":  func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-api"} },
+		"no audience":     func(c *Claims) { c.Audience = nil },
+		"no expiry":       func(c *Claims) { c.ExpiresAt = nil },
+		"refresh use":     func(c *Claims) { c.TokenUse = "refresh" },
+		"no token use":    func(c *Claims) { c.TokenUse = "" },
+		"bad subject":     func(c *Claims) { c.Subject = "admin" },
+		"issued too late": func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour)) },
+	}
+	for name, mutate := range cases {
+		c := valid()
+		mutate(&c)
+		_, err := ks.ParseJWT(signClaims(t, c, "secret"))
+		if !errors.Is(err, ErrTokenClaims) {
+			t.Errorf("%s: expected ErrTokenClaims, got %v", name, err)
+		}
+	}
+}
+
+func TestParseJWTLeeway(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	ks.Leeway = time.Minute
+	token, _ := ks.MakeSessionJWT(uuid.New(), uuid.Nil, -30*time.Second)
+	if _, err := ks.ParseJWT(token); err != nil {
+		t.Errorf("Token expired within the leeway should pass: %v", err)
+	}
+	ks.Leeway = 0
+	if _, err := ks.ParseJWT(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestParseJWTSentinelErrors(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	token, _ := ks.MakeSessionJWT(uuid.New(), uuid.Nil, time.Hour)
+	if _, err := ks.ParseJWT("not.a.jwt"); !errors.Is(err, ErrTokenMalformed) {
+		t.Errorf("Expected ErrTokenMalformed, got %v", err)
+	}
+	if _, err := NewHMACKeySet("other").ParseJWT(token); !errors.Is(err, ErrTokenSignature) {
+		t.Errorf("Expected ErrTokenSignature, got %v", err)
+	}
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.RegisteredClaims{}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := ks.ParseJWT(none); !errors.Is(err, ErrTokenSignature) {
+		t.Errorf("Expected alg none to fail with ErrTokenSignature, got %v", err)
+	}
+}
+
+func TestEmailJWT(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	userID := uuid.New()
+	token, err := ks.MakeEmailJWT(userID, "new@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailJWT: %v", err)
+	}
+	claims, err := ks.ParseEmailJWT(token)
+	if err != nil {
+		t.Fatalf("ParseEmailJWT: %v", err)
+	}
+	if claims.Subject != userID.String() || claims.Email != "new@example.com" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	// Neither kind of token may stand in for the other.
+	if _, err := ks.ParseJWT(token); !errors.Is(err, ErrTokenClaims) {
+		t.Errorf("Verification token accepted as an access token: %v", err)
+	}
+	access, _ := ks.MakeSessionJWT(userID, uuid.Nil, time.Hour)
+	if _, err := ks.ParseEmailJWT(access); !errors.Is(err, ErrTokenClaims) {
+		t.Errorf("Access token accepted as a verification token: %v", err)
+	}
+}
@@ -0,0 +1,520 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/CookieBorn/chirpy/internal/mail"
+	"github.com/joho/godotenv"
+)
+
+// Config holds every setting the server needs. It is loaded once at startup;
+// later sources override earlier ones: defaults, the TOML file, .env, the
+// process environment and finally command-line flags.
+type Config struct {
+	Addr            string
+	DBURL           string
+	JWTSecret       string
+	JWTKeyFiles     []string
+	JWTHS256        bool
+	JWTAudience     string
+	JWTLeeway       time.Duration
+	PolkaKey        string
+	AdminKey        string
+	Platform        string
+	JWTLifetime     time.Duration
+	RefreshLifetime time.Duration
+	FilterMode      string
+	FilterWordsFile string
+	LogLevel        string
+	LogFormat       string
+
+	LoginIPLimit          int
+	LoginAccountLimit     int
+	LoginLockoutThreshold int
+	LoginLockoutBase      time.Duration
+	LoginLockoutMax       time.Duration
+
+	RateLimitIP    int
+	RateLimitRead  Quota
+	RateLimitWrite Quota
+
+	PublicURL             string
+	Mailer                string
+	MailDir               string
+	MailFrom              string
+	PasswordResetLifetime time.Duration
+	PasswordResetLimit    int
+
+	EmailVerificationLifetime time.Duration
+	RequireVerifiedEmail      bool
+
+	ChirpEditWindow    time.Duration
+	ChirpRestoreWindow time.Duration
+	ChirpRetention     time.Duration
+	ChirpPurgeInterval time.Duration
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration
+}
+
+// Quota is the number of requests per minute a route group allows each
+// tier of caller. It is written "anonymous,user,red", e.g. "60,120,600".
+type Quota struct {
+	Anonymous int
+	User      int
+	Red       int
+}
+
+// fileConfig mirrors Config with TOML keys. Numbers and booleans are
+// native TOML values, durations are strings like "1h", and quotas and key
+// file lists are spelled the same as in the environment. Nil means unset.
+type fileConfig struct {
+	Addr            string    `toml:"addr"`
+	DBURL           string    `toml:"db_url"`
+	JWTSecret       string    `toml:"jwt_secret"`
+	JWTKeyFiles     string    `toml:"jwt_key_files"`
+	JWTHS256        *bool     `toml:"jwt_hs256_fallback"`
+	JWTAudience     string    `toml:"jwt_audience"`
+	JWTLeeway       *duration `toml:"jwt_leeway"`
+	PolkaKey        string    `toml:"polka_key"`
+	AdminKey        string    `toml:"admin_api_key"`
+	Platform        string    `toml:"platform"`
+	JWTLifetime     *duration `toml:"jwt_lifetime"`
+	RefreshLifetime *duration `toml:"refresh_token_lifetime"`
+	FilterMode      string    `toml:"filter_mode"`
+	FilterWordsFile string    `toml:"filter_words_file"`
+	LogLevel        string    `toml:"log_level"`
+	LogFormat       string    `toml:"log_format"`
+
+	LoginIPLimit          *int      `toml:"login_ip_limit"`
+	LoginAccountLimit     *int      `toml:"login_account_limit"`
+	LoginLockoutThreshold *int      `toml:"login_lockout_threshold"`
+	LoginLockoutBase      *duration `toml:"login_lockout_base"`
+	LoginLockoutMax       *duration `toml:"login_lockout_max"`
+
+	RateLimitIP    *int   `toml:"rate_limit_ip"`
+	RateLimitRead  string `toml:"rate_limit_read"`
+	RateLimitWrite string `toml:"rate_limit_write"`
+
+	PublicURL             string    `toml:"public_url"`
+	Mailer                string    `toml:"mailer"`
+	MailDir               string    `toml:"mail_dir"`
+	MailFrom              string    `toml:"mail_from"`
+	PasswordResetLifetime *duration `toml:"password_reset_lifetime"`
+	PasswordResetLimit    *int      `toml:"password_reset_limit"`
+
+	EmailVerificationLifetime *duration `toml:"email_verification_lifetime"`
+	RequireVerifiedEmail      *bool     `toml:"require_verified_email"`
+
+	ChirpEditWindow    *duration `toml:"chirp_edit_window"`
+	ChirpRestoreWindow *duration `toml:"chirp_restore_window"`
+	ChirpRetention     *duration `toml:"chirp_retention"`
+	ChirpPurgeInterval *duration `toml:"chirp_purge_interval"`
+
+	ReadTimeout       *duration `toml:"read_timeout"`
+	ReadHeaderTimeout *duration `toml:"read_header_timeout"`
+	WriteTimeout      *duration `toml:"write_timeout"`
+	IdleTimeout       *duration `toml:"idle_timeout"`
+	MaxHeaderBytes    *int      `toml:"max_header_bytes"`
+	ShutdownTimeout   *duration `toml:"shutdown_timeout"`
+}
+
+// duration reads a TOML string like "1h" as a time.Duration.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// fileInt, fileBool and fileDuration spell a config file value the way the
+// environment would, so every source goes through the same setters.
+func fileInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func fileBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+func fileDuration(d *duration) string {
+	if d == nil {
+		return ""
+	}
+	return d.String()
+}
+
+func Defaults() Config {
+	return Config{
+		Addr:            ":8081",
+		JWTLifetime:     time.Hour,
+		JWTAudience:     "chirpy",
+		JWTLeeway:       30 * time.Second,
+		RefreshLifetime: 60 * 24 * time.Hour,
+		LogLevel:        "info",
+		LogFormat:       "json",
+
+		LoginIPLimit:          20,
+		LoginAccountLimit:     5,
+		LoginLockoutThreshold: 5,
+		LoginLockoutBase:      time.Minute,
+		LoginLockoutMax:       time.Hour,
+
+		RateLimitIP:    1200,
+		RateLimitRead:  Quota{Anonymous: 60, User: 120, Red: 600},
+		RateLimitWrite: Quota{Anonymous: 10, User: 30, Red: 120},
+
+		PublicURL:             "http://localhost:8081",
+		Mailer:                "",
+		MailDir:               "mail",
+		MailFrom:              "Chirpy <no-reply@chirpy.local>",
+		PasswordResetLifetime: time.Hour,
+		PasswordResetLimit:    3,
+
+		EmailVerificationLifetime: 24 * time.Hour,
+
+		ChirpEditWindow:    15 * time.Minute,
+		ChirpRestoreWindow: 24 * time.Hour,
+		ChirpRetention:     30 * 24 * time.Hour,
+		ChirpPurgeInterval: time.Hour,
+
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		ShutdownTimeout:   15 * time.Second,
+	}
+}
+
+// setting ties one Config field to its file key, env var and flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	file  func(f fileConfig) string
+	set   func(c *Config, v string) error
+}
+
+func stringSetting(env, flagName, usage string, file func(f fileConfig) string, field func(c *Config) *string) setting {
+	return setting{env: env, flag: flagName, usage: usage, file: file, set: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func listSetting(env, flagName, usage string, file func(f fileConfig) string, field func(c *Config) *[]string) setting {
+	return setting{env: env, flag: flagName, usage: usage, file: file, set: func(c *Config, v string) error {
+		list := []string{}
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func boolSetting(env, flagName, usage string, file func(f fileConfig) string, field func(c *Config) *bool) setting {
+	return setting{env: env, flag: flagName, usage: usage, file: file, set: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func durationSetting(env, flagName, usage string, file func(f fileConfig) string, field func(c *Config) *time.Duration) setting {
+	return setting{env: env, flag: flagName, usage: usage, file: file, set: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+func intSetting(env, flagName, usage string, file func(f fileConfig) string, field func(c *Config) *int) setting {
+	return setting{env: env, flag: flagName, usage: usage, file: file, set: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func quotaSetting(env, flagName, usage string, file func(f fileConfig) string, field func(c *Config) *Quota) setting {
+	return setting{env: env, flag: flagName, usage: usage, file: file, set: func(c *Config, v string) error {
+		parts := strings.Split(v, ",")
+		if len(parts) != 3 {
+			return fmt.Errorf("%s: want anonymous,user,red", env)
+		}
+		n := [3]int{}
+		for i, part := range parts {
+			var err error
+			n[i], err = strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return fmt.Errorf("%s: %w", env, err)
+			}
+		}
+		*field(c) = Quota{Anonymous: n[0], User: n[1], Red: n[2]}
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("ADDR", "addr", "listen address", func(f fileConfig) string { return f.Addr }, func(c *Config) *string { return &c.Addr }),
+	stringSetting("DB_URL", "db-url", "Postgres connection string", func(f fileConfig) string { return f.DBURL }, func(c *Config) *string { return &c.DBURL }),
+	stringSetting("JWT_SECRET", "jwt-secret", "secret used to sign access tokens", func(f fileConfig) string { return f.JWTSecret }, func(c *Config) *string { return &c.JWTSecret }),
+	listSetting("JWT_KEY_FILES", "jwt-key-files", "comma-separated PEM keys for RS256/EdDSA access tokens; the first one signs", func(f fileConfig) string { return f.JWTKeyFiles }, func(c *Config) *[]string { return &c.JWTKeyFiles }),
+	boolSetting("JWT_HS256_FALLBACK", "jwt-hs256-fallback", "keep accepting HS256 access tokens signed with JWT_SECRET when JWT_KEY_FILES is set", func(f fileConfig) string { return fileBool(f.JWTHS256) }, func(c *Config) *bool { return &c.JWTHS256 }),
+	stringSetting("JWT_AUDIENCE", "jwt-audience", "aud claim written to and required in access tokens", func(f fileConfig) string { return f.JWTAudience }, func(c *Config) *string { return &c.JWTAudience }),
+	durationSetting("JWT_LEEWAY", "jwt-leeway", "clock skew tolerated when validating access tokens", func(f fileConfig) string { return fileDuration(f.JWTLeeway) }, func(c *Config) *time.Duration { return &c.JWTLeeway }),
+	stringSetting("POLKA_KEY", "polka-key", "API key Polka uses for webhooks", func(f fileConfig) string { return f.PolkaKey }, func(c *Config) *string { return &c.PolkaKey }),
+	stringSetting("ADMIN_API_KEY", "admin-api-key", "API key for /admin endpoints", func(f fileConfig) string { return f.AdminKey }, func(c *Config) *string { return &c.AdminKey }),
+	stringSetting("PLATFORM", "platform", "set to dev to enable /admin/reset", func(f fileConfig) string { return f.Platform }, func(c *Config) *string { return &c.Platform }),
+	durationSetting("JWT_LIFETIME", "jwt-lifetime", "access token lifetime", func(f fileConfig) string { return fileDuration(f.JWTLifetime) }, func(c *Config) *time.Duration { return &c.JWTLifetime }),
+	durationSetting("REFRESH_TOKEN_LIFETIME", "refresh-token-lifetime", "refresh token lifetime", func(f fileConfig) string { return fileDuration(f.RefreshLifetime) }, func(c *Config) *time.Duration { return &c.RefreshLifetime }),
+	stringSetting("FILTER_MODE", "filter-mode", "content filter mode: replace, reject or flag", func(f fileConfig) string { return f.FilterMode }, func(c *Config) *string { return &c.FilterMode }),
+	stringSetting("FILTER_WORDS_FILE", "filter-words-file", "extra banned words, one per line", func(f fileConfig) string { return f.FilterWordsFile }, func(c *Config) *string { return &c.FilterWordsFile }),
+	stringSetting("LOG_LEVEL", "log-level", "debug, info, warn or error", func(f fileConfig) string { return f.LogLevel }, func(c *Config) *string { return &c.LogLevel }),
+	stringSetting("LOG_FORMAT", "log-format", "json or text", func(f fileConfig) string { return f.LogFormat }, func(c *Config) *string { return &c.LogFormat }),
+	intSetting("LOGIN_IP_LIMIT", "login-ip-limit", "login attempts allowed per minute from one IP", func(f fileConfig) string { return fileInt(f.LoginIPLimit) }, func(c *Config) *int { return &c.LoginIPLimit }),
+	intSetting("LOGIN_ACCOUNT_LIMIT", "login-account-limit", "login attempts allowed per minute for one email", func(f fileConfig) string { return fileInt(f.LoginAccountLimit) }, func(c *Config) *int { return &c.LoginAccountLimit }),
+	intSetting("LOGIN_LOCKOUT_THRESHOLD", "login-lockout-threshold", "failed logins before an account is locked", func(f fileConfig) string { return fileInt(f.LoginLockoutThreshold) }, func(c *Config) *int { return &c.LoginLockoutThreshold }),
+	durationSetting("LOGIN_LOCKOUT_BASE", "login-lockout-base", "first lockout; doubles with every further failure", func(f fileConfig) string { return fileDuration(f.LoginLockoutBase) }, func(c *Config) *time.Duration { return &c.LoginLockoutBase }),
+	durationSetting("LOGIN_LOCKOUT_MAX", "login-lockout-max", "longest lockout", func(f fileConfig) string { return fileDuration(f.LoginLockoutMax) }, func(c *Config) *time.Duration { return &c.LoginLockoutMax }),
+	intSetting("RATE_LIMIT_IP", "rate-limit-ip", "requests per minute from one IP across every endpoint", func(f fileConfig) string { return fileInt(f.RateLimitIP) }, func(c *Config) *int { return &c.RateLimitIP }),
+	quotaSetting("RATE_LIMIT_READ", "rate-limit-read", "read requests per minute as anonymous,user,red", func(f fileConfig) string { return f.RateLimitRead }, func(c *Config) *Quota { return &c.RateLimitRead }),
+	quotaSetting("RATE_LIMIT_WRITE", "rate-limit-write", "write requests per minute as anonymous,user,red", func(f fileConfig) string { return f.RateLimitWrite }, func(c *Config) *Quota { return &c.RateLimitWrite }),
+	stringSetting("PUBLIC_URL", "public-url", "base URL used in links sent by email", func(f fileConfig) string { return f.PublicURL }, func(c *Config) *string { return &c.PublicURL }),
+	stringSetting("MAILER", "mailer", "how to deliver email: log (dev only) or file; defaults to log on the dev platform and file elsewhere", func(f fileConfig) string { return f.Mailer }, func(c *Config) *string { return &c.Mailer }),
+	stringSetting("MAIL_DIR", "mail-dir", "directory the file mailer writes to", func(f fileConfig) string { return f.MailDir }, func(c *Config) *string { return &c.MailDir }),
+	stringSetting("MAIL_FROM", "mail-from", "From address of outgoing email", func(f fileConfig) string { return f.MailFrom }, func(c *Config) *string { return &c.MailFrom }),
+	durationSetting("PASSWORD_RESET_LIFETIME", "password-reset-lifetime", "how long a password reset link works", func(f fileConfig) string { return fileDuration(f.PasswordResetLifetime) }, func(c *Config) *time.Duration { return &c.PasswordResetLifetime }),
+	intSetting("PASSWORD_RESET_LIMIT", "password-reset-limit", "password reset emails allowed per hour for one address", func(f fileConfig) string { return fileInt(f.PasswordResetLimit) }, func(c *Config) *int { return &c.PasswordResetLimit }),
+	durationSetting("EMAIL_VERIFICATION_LIFETIME", "email-verification-lifetime", "how long an email verification link works", func(f fileConfig) string { return fileDuration(f.EmailVerificationLifetime) }, func(c *Config) *time.Duration { return &c.EmailVerificationLifetime }),
+	boolSetting("REQUIRE_VERIFIED_EMAIL", "require-verified-email", "only let users with a verified email post chirps", func(f fileConfig) string { return fileBool(f.RequireVerifiedEmail) }, func(c *Config) *bool { return &c.RequireVerifiedEmail }),
+	durationSetting("CHIRP_EDIT_WINDOW", "chirp-edit-window", "how long after posting a chirp can be edited; 0 disables editing", func(f fileConfig) string { return fileDuration(f.ChirpEditWindow) }, func(c *Config) *time.Duration { return &c.ChirpEditWindow }),
+	durationSetting("CHIRP_RESTORE_WINDOW", "chirp-restore-window", "how long after deleting a chirp its author can restore it", func(f fileConfig) string { return fileDuration(f.ChirpRestoreWindow) }, func(c *Config) *time.Duration { return &c.ChirpRestoreWindow }),
+	durationSetting("CHIRP_RETENTION", "chirp-retention", "how long deleted chirps are kept for review before they are purged", func(f fileConfig) string { return fileDuration(f.ChirpRetention) }, func(c *Config) *time.Duration { return &c.ChirpRetention }),
+	durationSetting("CHIRP_PURGE_INTERVAL", "chirp-purge-interval", "how often deleted chirps past retention are purged", func(f fileConfig) string { return fileDuration(f.ChirpPurgeInterval) }, func(c *Config) *time.Duration { return &c.ChirpPurgeInterval }),
+	durationSetting("READ_TIMEOUT", "read-timeout", "maximum time to read a request", func(f fileConfig) string { return fileDuration(f.ReadTimeout) }, func(c *Config) *time.Duration { return &c.ReadTimeout }),
+	durationSetting("READ_HEADER_TIMEOUT", "read-header-timeout", "maximum time to read request headers", func(f fileConfig) string { return fileDuration(f.ReadHeaderTimeout) }, func(c *Config) *time.Duration { return &c.ReadHeaderTimeout }),
+	durationSetting("WRITE_TIMEOUT", "write-timeout", "maximum time to write a response", func(f fileConfig) string { return fileDuration(f.WriteTimeout) }, func(c *Config) *time.Duration { return &c.WriteTimeout }),
+	durationSetting("IDLE_TIMEOUT", "idle-timeout", "how long keep-alive connections stay open", func(f fileConfig) string { return fileDuration(f.IdleTimeout) }, func(c *Config) *time.Duration { return &c.IdleTimeout }),
+	intSetting("MAX_HEADER_BYTES", "max-header-bytes", "maximum size of request headers", func(f fileConfig) string { return fileInt(f.MaxHeaderBytes) }, func(c *Config) *int { return &c.MaxHeaderBytes }),
+	durationSetting("SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long to drain in-flight requests on shutdown", func(f fileConfig) string { return fileDuration(f.ShutdownTimeout) }, func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+}
+
+// Load builds the Config from args (usually os.Args[1:]) and the environment.
+func Load(args []string) (Config, error) {
+	cfg := Defaults()
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CHIRPY_CONFIG"), "path to a TOML config file")
+	envFile := fs.String("env-file", ".env", "path to a .env file")
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		flagValues[s.flag] = fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, err
+	}
+
+	if *configFile != "" {
+		fc := fileConfig{}
+		_, err := toml.DecodeFile(*configFile, &fc)
+		if err != nil {
+			return cfg, fmt.Errorf("config file: %w", err)
+		}
+		for _, s := range settings {
+			if v := s.file(fc); v != "" {
+				err := s.set(&cfg, v)
+				if err != nil {
+					return cfg, err
+				}
+			}
+		}
+	}
+
+	// godotenv never overrides variables that are already set, so the real
+	// environment wins over .env.
+	err = godotenv.Load(*envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("env file: %w", err)
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			err := s.set(&cfg, v)
+			if err != nil {
+				return cfg, err
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				flagErr = s.set(&cfg, *flagValues[s.flag])
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, flagErr
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports every missing or invalid setting at once.
+func (c Config) Validate() error {
+	problems := []string{}
+	if c.DBURL == "" {
+		problems = append(problems, "DB_URL is required")
+	}
+	if c.JWTSecret == "" && (len(c.JWTKeyFiles) == 0 || c.JWTHS256) {
+		problems = append(problems, "JWT_SECRET is required unless JWT_KEY_FILES is set")
+	}
+	if c.PolkaKey == "" {
+		problems = append(problems, "POLKA_KEY is required")
+	}
+	if c.Addr == "" {
+		problems = append(problems, "ADDR must not be empty")
+	}
+	if c.JWTLifetime <= 0 {
+		problems = append(problems, "JWT_LIFETIME must be positive")
+	}
+	if c.JWTAudience == "" {
+		problems = append(problems, "JWT_AUDIENCE must not be empty")
+	}
+	if c.JWTLeeway < 0 {
+		problems = append(problems, "JWT_LEEWAY must not be negative")
+	}
+	if c.RefreshLifetime <= 0 {
+		problems = append(problems, "REFRESH_TOKEN_LIFETIME must be positive")
+	}
+	if c.LoginIPLimit <= 0 || c.LoginAccountLimit <= 0 || c.LoginLockoutThreshold <= 0 {
+		problems = append(problems, "login limits must be positive")
+	}
+	if c.LoginLockoutBase <= 0 || c.LoginLockoutMax < c.LoginLockoutBase {
+		problems = append(problems, "LOGIN_LOCKOUT_BASE must be positive and no more than LOGIN_LOCKOUT_MAX")
+	}
+	if c.RateLimitIP <= 0 {
+		problems = append(problems, "RATE_LIMIT_IP must be positive")
+	}
+	for _, q := range []Quota{c.RateLimitRead, c.RateLimitWrite} {
+		if q.Anonymous <= 0 || q.User <= 0 || q.Red <= 0 {
+			problems = append(problems, "rate limit quotas must be positive")
+			break
+		}
+	}
+	switch c.Mailer {
+	case "", "file":
+	case "log":
+		// The log mailer writes reset and verification links in the clear,
+		// so anyone with the logs could take over accounts.
+		if c.Platform != "dev" {
+			problems = append(problems, "MAILER=log is only allowed with PLATFORM=dev")
+		}
+	default:
+		problems = append(problems, "MAILER must be log or file")
+	}
+	if c.PasswordResetLifetime <= 0 {
+		problems = append(problems, "PASSWORD_RESET_LIFETIME must be positive")
+	}
+	if c.PasswordResetLimit <= 0 {
+		problems = append(problems, "PASSWORD_RESET_LIMIT must be positive")
+	}
+	if c.EmailVerificationLifetime <= 0 {
+		problems = append(problems, "EMAIL_VERIFICATION_LIFETIME must be positive")
+	}
+	if c.ChirpEditWindow < 0 {
+		problems = append(problems, "CHIRP_EDIT_WINDOW must not be negative")
+	}
+	if c.ChirpRestoreWindow < 0 {
+		problems = append(problems, "CHIRP_RESTORE_WINDOW must not be negative")
+	}
+	if c.ChirpRetention < c.ChirpRestoreWindow {
+		problems = append(problems, "CHIRP_RETENTION must not be shorter than CHIRP_RESTORE_WINDOW")
+	}
+	if c.ChirpPurgeInterval <= 0 {
+		problems = append(problems, "CHIRP_PURGE_INTERVAL must be positive")
+	}
+	if c.ReadTimeout < 0 || c.ReadHeaderTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		problems = append(problems, "server timeouts must not be negative")
+	}
+	if c.MaxHeaderBytes <= 0 {
+		problems = append(problems, "MAX_HEADER_BYTES must be positive")
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		problems = append(problems, "LOG_FORMAT must be json or text")
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, "SHUTDOWN_TIMEOUT must be positive")
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// HMACSecret is the HS256 secret the server should honour: always when
+// there are no key files, otherwise only as an explicit fallback.
+func (c Config) HMACSecret() string {
+	if len(c.JWTKeyFiles) == 0 || c.JWTHS256 {
+		return c.JWTSecret
+	}
+	return ""
+}
+
+// NewMailer builds the Mailer described by Mailer and MailDir. Without an
+// explicit choice only the dev platform logs email.
+func (c Config) NewMailer(logger *slog.Logger) mail.Mailer {
+	if c.Mailer == "log" || (c.Mailer == "" && c.Platform == "dev") {
+		return mail.LogMailer{Logger: logger}
+	}
+	return mail.FileMailer{Dir: c.MailDir}
+}
+
+// NewLogger builds the process logger described by LogLevel and LogFormat.
+func (c Config) NewLogger(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	if err != nil {
+		return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if c.LogFormat == "text" {
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return slog.New(slog.NewJSONHandler(w, opts)), nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/mail"
+)
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(contents), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// unsetEnv removes key for the duration of the test. godotenv only fills in
+// variables that are not set at all, so t.Setenv(key, "") isn't enough.
+func unsetEnv(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for _, key := range []string{"ADDR", "DB_URL", "POLKA_KEY", "JWT_LIFETIME", "REFRESH_TOKEN_LIFETIME"} {
+		unsetEnv(t, key)
+	}
+	configFile := writeFile(t, "chirpy.toml", `
+addr = ":9000"
+db_url = "postgres://file"
+jwt_secret = "file-secret"
+polka_key = "file-polka"
+jwt_lifetime = "30m"
+`)
+	envFile := writeFile(t, ".env", "POLKA_KEY=dotenv-polka\nJWT_SECRET=dotenv-secret\n")
+	t.Setenv("JWT_SECRET", "env-secret")
+
+	cfg, err := Load([]string{"-config", configFile, "-env-file", envFile, "-addr", ":9999"})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Addr != ":9999" {
+		t.Errorf("Flag should win, got addr %q", cfg.Addr)
+	}
+	if cfg.JWTSecret != "env-secret" {
+		t.Errorf("Environment should beat .env, got %q", cfg.JWTSecret)
+	}
+	if cfg.PolkaKey != "dotenv-polka" {
+		t.Errorf(".env should beat the config file, got %q", cfg.PolkaKey)
+	}
+	if cfg.DBURL != "postgres://file" {
+		t.Errorf("Config file value missing, got %q", cfg.DBURL)
+	}
+	if cfg.JWTLifetime != 30*time.Minute {
+		t.Errorf("Expected 30m JWT lifetime, got %v", cfg.JWTLifetime)
+	}
+	if cfg.RefreshLifetime != Defaults().RefreshLifetime {
+		t.Errorf("Expected default refresh lifetime, got %v", cfg.RefreshLifetime)
+	}
+}
+
+func TestLoadMissingRequired(t *testing.T) {
+	for _, key := range []string{"DB_URL", "JWT_SECRET", "POLKA_KEY"} {
+		t.Setenv(key, "")
+	}
+	_, err := Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	if err == nil {
+		t.Fatal("Expected an error for missing required settings")
+	}
+	for _, key := range []string{"DB_URL", "JWT_SECRET", "POLKA_KEY"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Error should mention %s: %v", key, err)
+		}
+	}
+}
+
+func TestLoadBadDuration(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://env")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("POLKA_KEY", "polka")
+	t.Setenv("JWT_LIFETIME", "forever")
+	_, err := Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	if err == nil {
+		t.Fatal("Expected an error for an invalid duration")
+	}
+}
+
+func TestLoadRetentionShorterThanRestoreWindow(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://env")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("POLKA_KEY", "polka")
+	t.Setenv("CHIRP_RESTORE_WINDOW", "48h")
+	t.Setenv("CHIRP_RETENTION", "24h")
+	_, err := Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	if err == nil || !strings.Contains(err.Error(), "CHIRP_RETENTION") {
+		t.Fatalf("Expected a CHIRP_RETENTION error, got %v", err)
+	}
+}
+
+func TestLogMailerDevOnly(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://env")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("POLKA_KEY", "polka")
+	t.Setenv("MAILER", "log")
+	t.Setenv("PLATFORM", "prod")
+	_, err := Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	if err == nil || !strings.Contains(err.Error(), "MAILER") {
+		t.Fatalf("Expected a MAILER error, got %v", err)
+	}
+	t.Setenv("PLATFORM", "dev")
+	cfg, err := Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if _, ok := cfg.NewMailer(nil).(mail.LogMailer); !ok {
+		t.Errorf("Expected the log mailer on dev, got %T", cfg.NewMailer(nil))
+	}
+	unsetEnv(t, "MAILER")
+	t.Setenv("PLATFORM", "prod")
+	cfg, err = Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if _, ok := cfg.NewMailer(nil).(mail.FileMailer); !ok {
+		t.Errorf("Expected the file mailer by default off dev, got %T", cfg.NewMailer(nil))
+	}
+}
+
+func TestLoadJWTKeyFiles(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://env")
+	t.Setenv("POLKA_KEY", "polka")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_KEY_FILES", "new.pem, old.pem,")
+	missingEnv := filepath.Join(t.TempDir(), "missing.env")
+	cfg, err := Load([]string{"-env-file", missingEnv})
+	if err != nil {
+		t.Fatalf("JWT_SECRET should be optional with key files: %v", err)
+	}
+	if len(cfg.JWTKeyFiles) != 2 || cfg.JWTKeyFiles[0] != "new.pem" || cfg.JWTKeyFiles[1] != "old.pem" {
+		t.Errorf("Unexpected key files %q", cfg.JWTKeyFiles)
+	}
+	if cfg.HMACSecret() != "" {
+		t.Errorf("HS256 should be off without the fallback")
+	}
+
+	_, err = Load([]string{"-env-file", missingEnv, "-jwt-hs256-fallback", "true"})
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Errorf("The HS256 fallback needs JWT_SECRET, got %v", err)
+	}
+}
+
+func TestLoadRateLimitQuota(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://env")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("POLKA_KEY", "polka")
+	t.Setenv("RATE_LIMIT_WRITE", "5, 20,100")
+	missingEnv := filepath.Join(t.TempDir(), "missing.env")
+	cfg, err := Load([]string{"-env-file", missingEnv})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.RateLimitWrite != (Quota{Anonymous: 5, User: 20, Red: 100}) {
+		t.Errorf("Unexpected write quota %+v", cfg.RateLimitWrite)
+	}
+	if cfg.RateLimitRead != Defaults().RateLimitRead {
+		t.Errorf("Expected the default read quota, got %+v", cfg.RateLimitRead)
+	}
+	for _, bad := range []string{"5,20", "5,x,100", "0,20,100"} {
+		t.Setenv("RATE_LIMIT_WRITE", bad)
+		if _, err := Load([]string{"-env-file", missingEnv}); err == nil {
+			t.Errorf("Expected an error for RATE_LIMIT_WRITE=%q", bad)
+		}
+	}
+}
+
+func TestLoadNativeTOMLValues(t *testing.T) {
+	for _, key := range []string{"LOGIN_IP_LIMIT", "RATE_LIMIT_IP", "REQUIRE_VERIFIED_EMAIL", "CHIRP_EDIT_WINDOW", "JWT_LIFETIME"} {
+		unsetEnv(t, key)
+	}
+	t.Setenv("DB_URL", "postgres://env")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("POLKA_KEY", "polka")
+	configFile := writeFile(t, "chirpy.toml", `
+login_ip_limit = 7
+rate_limit_ip = 100
+require_verified_email = true
+chirp_edit_window = "0s"
+jwt_lifetime = "30m"
+`)
+	cfg, err := Load([]string{"-config", configFile, "-env-file", filepath.Join(t.TempDir(), "missing.env")})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.LoginIPLimit != 7 || cfg.RateLimitIP != 100 {
+		t.Errorf("Unexpected limits: login %d, ip %d", cfg.LoginIPLimit, cfg.RateLimitIP)
+	}
+	if !cfg.RequireVerifiedEmail {
+		t.Error("require_verified_email = true was not applied")
+	}
+	if cfg.ChirpEditWindow != 0 || cfg.JWTLifetime != 30*time.Minute {
+		t.Errorf("Unexpected durations: edit window %v, JWT lifetime %v", cfg.ChirpEditWindow, cfg.JWTLifetime)
+	}
+}
@@ -7,29 +7,34 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.InReplyTo)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,23 +42,58 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE from chirps
-WHERE id = $1
+const editChirp = `-- name: EditChirp :one
+WITH old AS (
+    SELECT id, body, updated_at from chirps
+    WHERE id = $1 AND deleted_at IS NULL
+      AND created_at >= NOW() - make_interval(secs => $2::float8)
+    FOR UPDATE
+), revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), old.id, old.body, old.updated_at, NOW() from old
+    WHERE old.body <> $3
+)
+UPDATE chirps
+SET body = $3,
+    updated_at = CASE WHEN old.body = $3 THEN chirps.updated_at ELSE NOW() END
+FROM old
+WHERE chirps.id = old.id
+RETURNING chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
+type EditChirpParams struct {
+	ID            uuid.UUID
+	WindowSeconds float64
+	Body          string
+}
+
+// Saves the current body as a revision and replaces it in one statement, so
+// an edit never loses the text it overwrote. Nothing matches once the edit
+// window has passed, and an unchanged body leaves no revision behind.
+func (q *Queries) EditChirp(ctx context.Context, arg EditChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, editChirp, arg.ID, arg.WindowSeconds, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+	)
+	return i, err
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id from chirps
-WHERE id=$1
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from chirps
+WHERE id=$1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -65,17 +105,149 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const getChirpsAll = `-- name: GetChirpsAll :many
-SELECT id, created_at, updated_at, body, user_id from chirps
-ORDER BY created_at
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at, 1 AS depth
+    FROM chirps c
+    WHERE c.id = (SELECT r.in_reply_to FROM chirps r WHERE r.id = $1)
+    AND c.deleted_at IS NULL
+    UNION ALL
+    SELECT p.id, p.created_at, p.updated_at, p.body, p.user_id, p.in_reply_to, p.deleted_at, a.depth + 1
+    FROM chirps p
+    JOIN ancestors a ON p.id = a.in_reply_to
+    WHERE p.deleted_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from ancestors
+ORDER BY depth DESC
+`
+
+type GetChirpAncestorsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]GetChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAncestorsRow
+	for rows.Next() {
+		var i GetChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at
+    FROM chirps c
+    WHERE c.in_reply_to = $1 AND c.deleted_at IS NULL
+    UNION ALL
+    SELECT r.id, r.created_at, r.updated_at, r.body, r.user_id, r.in_reply_to, r.deleted_at
+    FROM chirps r
+    JOIN descendants d ON r.in_reply_to = d.id
+    WHERE r.deleted_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from descendants
+ORDER BY created_at, id
 `
 
-func (q *Queries) GetChirpsAll(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsAll)
+type GetChirpDescendantsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, inReplyTo uuid.NullUUID) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, inReplyTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPageAsc = `-- name: GetChirpsPageAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from chirps
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+ORDER BY created_at, id
+LIMIT $4
+`
+
+type GetChirpsPageAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetChirpsPageAsc(ctx context.Context, arg GetChirpsPageAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPageAsc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +261,8 @@ func (q *Queries) GetChirpsAll(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -103,14 +277,30 @@ func (q *Queries) GetChirpsAll(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpsAllAuthor = `-- name: GetChirpsAllAuthor :many
-SELECT id, created_at, updated_at, body, user_id from chirps
-WHERE user_id=$1
-ORDER BY created_at
+const getChirpsPageDesc = `-- name: GetChirpsPageDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from chirps
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND ($2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChirpsAllAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsAllAuthor, userID)
+type GetChirpsPageDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetChirpsPageDesc(ctx context.Context, arg GetChirpsPageDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPageDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +314,8 @@ func (q *Queries) GetChirpsAllAuthor(ctx context.Context, userID uuid.UUID) ([]C
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -137,3 +329,235 @@ func (q *Queries) GetChirpsAllAuthor(ctx context.Context, userID uuid.UUID) ([]C
 	}
 	return items, nil
 }
+
+const getDeletedChirp = `-- name: GetDeletedChirp :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from chirps
+WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) GetDeletedChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getDeletedChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getDeletedChirps = `-- name: GetDeletedChirps :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from chirps
+WHERE deleted_at IS NOT NULL
+AND ($1::timestamp IS NULL
+    OR (deleted_at, id) < ($1::timestamp, $2::uuid))
+ORDER BY deleted_at DESC, id DESC
+LIMIT $3
+`
+
+type GetDeletedChirpsParams struct {
+	CursorDeletedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetDeletedChirps(ctx context.Context, arg GetDeletedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getDeletedChirps, arg.CursorDeletedAt, arg.CursorID, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReplyCounts = `-- name: GetReplyCounts :many
+SELECT in_reply_to, COUNT(*) AS reply_count from chirps
+WHERE in_reply_to = ANY($1::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to
+`
+
+type GetReplyCountsRow struct {
+	InReplyTo  uuid.NullUUID
+	ReplyCount int64
+}
+
+func (q *Queries) GetReplyCounts(ctx context.Context, ids []uuid.UUID) ([]GetReplyCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getReplyCounts, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReplyCountsRow
+	for rows.Next() {
+		var i GetReplyCountsRow
+		if err := rows.Scan(&i.InReplyTo, &i.ReplyCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE from chirps
+WHERE deleted_at < NOW() - make_interval(secs => $1::float8)
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, retentionSeconds float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, retentionSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+  AND deleted_at >= NOW() - make_interval(secs => $2::float8)
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
+`
+
+type RestoreChirpParams struct {
+	ID            uuid.UUID
+	WindowSeconds float64
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.WindowSeconds)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, rank FROM (
+    SELECT id, created_at, updated_at, body, user_id, in_reply_to,
+        ts_rank(to_tsvector('english', body), to_tsquery('english', $1))::real AS rank
+    FROM chirps
+    WHERE to_tsvector('english', body) @@ to_tsquery('english', $1)
+    AND deleted_at IS NULL
+    AND ($2::uuid IS NULL OR user_id = $2)
+    AND ($3::timestamp IS NULL OR created_at >= $3)
+    AND ($4::timestamp IS NULL OR created_at < $4)
+) ranked
+WHERE ($5::timestamp IS NULL
+    OR (rank, created_at, id) < ($6::real, $5::timestamp, $7::uuid))
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $8
+`
+
+type SearchChirpsParams struct {
+	Query           string
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorCreatedAt sql.NullTime
+	CursorRank      sql.NullFloat64
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+type SearchChirpsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	Rank      float32
+}
+
+// Filters on the same expression as chirps_body_search_idx so the GIN index
+// is used, and only the matching rows are ranked.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.CursorCreatedAt,
+		arg.CursorRank,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	return err
+}
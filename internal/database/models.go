@@ -11,28 +11,94 @@ import (
 	"github.com/google/uuid"
 )
 
+type BannedWord struct {
+	Word      string
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpFlag struct {
+	ChirpID   uuid.UUID
+	Matches   []string
 	CreatedAt time.Time
-	UpdatedAt time.Time
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type ChirpTag struct {
+	ChirpID   uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginFailure struct {
+	Email        string
+	FailedCount  int32
+	LastFailedAt time.Time
+	LockedUntil  sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	RotatedAt  sql.NullTime
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
 }
 
 type User struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Email       string
-	Password    string
-	IsChirpyRed bool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	Password        string
+	IsChirpyRed     bool
+	EmailVerifiedAt sql.NullTime
+	PendingEmail    sql.NullString
 }
@@ -13,63 +13,249 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip, last_used_at)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW()
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
+	TokenHash string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
+	FamilyID  uuid.UUID
+	UserAgent string
+	Ip        string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.Ip,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-Select token, created_at, updated_at, user_id, expires_at, revoked_at from refresh_tokens
-Where token=$1
+Select token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at from refresh_tokens
+Where token_hash=$1
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
+const getUserSessions = `-- name: GetUserSessions :many
+SELECT refresh_tokens.family_id, refresh_tokens.user_agent, refresh_tokens.ip, refresh_tokens.last_used_at, refresh_tokens.expires_at,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::timestamp AS started_at
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
+  AND refresh_tokens.rotated_at IS NULL
+  AND refresh_tokens.revoked_at IS NULL
+  AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC
+`
+
+type GetUserSessionsRow struct {
+	FamilyID   uuid.UUID
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	StartedAt  time.Time
+}
+
+func (q *Queries) GetUserSessions(ctx context.Context, userID uuid.UUID) ([]GetUserSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSessionsRow
+	for rows.Next() {
+		var i GetUserSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.StartedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isSessionActive = `-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE family_id = $1
+      AND rotated_at IS NULL
+      AND revoked_at IS NULL
+)
+`
+
+// A session is live while its family still has an unrotated, unrevoked
+// refresh token. Logging out or revoking the session ends it.
+func (q *Queries) IsSessionActive(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isSessionActive, familyID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOtherSessions, arg.UserID, arg.FamilyID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 set revoked_at = NOW(), updated_at = NOW()
-Where user_id=$1
+Where token_hash=$1
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, userID uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, userID)
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
 	return err
 }
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+set revoked_at = NOW(), updated_at = NOW()
+Where family_id=$1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+WITH rotated AS (
+    UPDATE refresh_tokens
+    SET rotated_at = NOW(), updated_at = NOW()
+    WHERE refresh_tokens.token_hash = $1
+      AND rotated_at IS NULL
+      AND revoked_at IS NULL
+    RETURNING user_id, family_id
+)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip, last_used_at)
+SELECT $2, NOW(), NOW(), rotated.user_id, $3, rotated.family_id, $4, $5, NOW()
+FROM rotated
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at
+`
+
+type RotateRefreshTokenParams struct {
+	OldTokenHash string
+	NewTokenHash string
+	ExpiresAt    time.Time
+	UserAgent    string
+	Ip           string
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken,
+		arg.OldTokenHash,
+		arg.NewTokenHash,
+		arg.ExpiresAt,
+		arg.UserAgent,
+		arg.Ip,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -51,7 +52,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 }
 
 const getUserEmail = `-- name: GetUserEmail :one
-SELECT id, created_at, updated_at, email, password, is_chirpy_red from users
+SELECT id, created_at, updated_at, email, password, is_chirpy_red, email_verified_at, pending_email from users
 where email=$1
 `
 
@@ -65,6 +66,8 @@ func (q *Queries) GetUserEmail(ctx context.Context, email string) (User, error)
 		&i.Email,
 		&i.Password,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
 	)
 	return i, err
 }
@@ -81,6 +84,36 @@ func (q *Queries) GetUserEmailFromID(ctx context.Context, id uuid.UUID) (string,
 	return email, err
 }
 
+const getUserIsChirpyRed = `-- name: GetUserIsChirpyRed :one
+SELECT is_chirpy_red from users
+where id=$1
+`
+
+func (q *Queries) GetUserIsChirpyRed(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, getUserIsChirpyRed, id)
+	var is_chirpy_red bool
+	err := row.Scan(&is_chirpy_red)
+	return is_chirpy_red, err
+}
+
+const getUserVerification = `-- name: GetUserVerification :one
+SELECT email, pending_email, email_verified_at from users
+where id=$1
+`
+
+type GetUserVerificationRow struct {
+	Email           string
+	PendingEmail    sql.NullString
+	EmailVerifiedAt sql.NullTime
+}
+
+func (q *Queries) GetUserVerification(ctx context.Context, id uuid.UUID) (GetUserVerificationRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserVerification, id)
+	var i GetUserVerificationRow
+	err := row.Scan(&i.Email, &i.PendingEmail, &i.EmailVerifiedAt)
+	return i, err
+}
+
 const reset = `-- name: Reset :exec
 DELETE from users
 `
@@ -90,30 +123,72 @@ func (q *Queries) Reset(ctx context.Context) error {
 	return err
 }
 
-const setUserToRed = `-- name: SetUserToRed :exec
+const setUserToRed = `-- name: SetUserToRed :execrows
 UPDATE users
 set is_chirpy_red = true
 Where id=$1
 `
 
-func (q *Queries) SetUserToRed(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, setUserToRed, id)
+func (q *Queries) SetUserToRed(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserToRed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserPendingEmail = `-- name: SetUserPendingEmail :exec
+UPDATE users
+set pending_email = $2, updated_at = NOW()
+Where id=$1
+`
+
+type SetUserPendingEmailParams struct {
+	ID           uuid.UUID
+	PendingEmail sql.NullString
+}
+
+func (q *Queries) SetUserPendingEmail(ctx context.Context, arg SetUserPendingEmailParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPendingEmail, arg.ID, arg.PendingEmail)
 	return err
 }
 
-const updateUserEmailPassword = `-- name: UpdateUserEmailPassword :exec
+const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users
-set email = $1, updated_at = NOW(), password = $2
-Where id=$3
+set password = $2, updated_at = NOW()
+Where id=$1
 `
 
-type UpdateUserEmailPasswordParams struct {
-	Email    string
-	Password string
+type UpdateUserPasswordParams struct {
 	ID       uuid.UUID
+	Password string
 }
 
-func (q *Queries) UpdateUserEmailPassword(ctx context.Context, arg UpdateUserEmailPasswordParams) error {
-	_, err := q.db.ExecContext(ctx, updateUserEmailPassword, arg.Email, arg.Password, arg.ID)
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.Password)
 	return err
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users
+set email = $1,
+    pending_email = NULLIF(pending_email, $1),
+    email_verified_at = $2::timestamp,
+    updated_at = NOW()
+Where id = $3
+AND (email = $1 OR pending_email = $1)
+`
+
+type VerifyUserEmailParams struct {
+	Email      string
+	VerifiedAt time.Time
+	ID         uuid.UUID
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyUserEmail, arg.Email, arg.VerifiedAt, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,175 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type Mode string
+
+const (
+	// ModeReplace masks banned words and lets the chirp through.
+	ModeReplace Mode = "replace"
+	// ModeReject refuses chirps containing banned words.
+	ModeReject Mode = "reject"
+	// ModeFlag stores the chirp unchanged and marks it for review.
+	ModeFlag Mode = "flag"
+)
+
+const Replacement = "****"
+
+var DefaultWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+// Verdict is the outcome of checking a chirp body.
+type Verdict struct {
+	Body    string
+	Matches []string
+	Reject  bool
+	Flag    bool
+}
+
+type ContentFilter interface {
+	Check(body string) Verdict
+	SetWords(words []string)
+}
+
+// WordList matches whole words against a list of banned words after
+// normalizing case, accents, compatibility forms, zero-width characters and
+// common lookalike letters. It is safe for concurrent use, so the list can be
+// swapped at runtime.
+type WordList struct {
+	mode  Mode
+	mu    sync.RWMutex
+	words map[string]struct{}
+}
+
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "":
+		return ModeReplace, nil
+	case ModeReplace, ModeReject, ModeFlag:
+		return Mode(s), nil
+	}
+	return "", errors.New("filter mode must be replace, reject or flag")
+}
+
+func NewWordList(mode Mode, words []string) *WordList {
+	w := &WordList{mode: mode}
+	w.SetWords(words)
+	return w
+}
+
+func (w *WordList) Mode() Mode {
+	return w.mode
+}
+
+func (w *WordList) SetWords(words []string) {
+	set := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		n := Normalize(word)
+		if n != "" {
+			set[n] = struct{}{}
+		}
+	}
+	w.mu.Lock()
+	w.words = set
+	w.mu.Unlock()
+}
+
+func (w *WordList) Words() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	words := make([]string, 0, len(w.words))
+	for word := range w.words {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+func (w *WordList) Check(body string) Verdict {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	verdict := Verdict{Body: body}
+	var out strings.Builder
+	last := 0
+	for _, span := range wordSpans(body) {
+		word := body[span[0]:span[1]]
+		n := Normalize(word)
+		if !w.banned(n) {
+			continue
+		}
+		verdict.Matches = append(verdict.Matches, n)
+		out.WriteString(body[last:span[0]])
+		out.WriteString(Replacement)
+		last = span[1]
+	}
+	if len(verdict.Matches) == 0 {
+		return verdict
+	}
+	switch w.mode {
+	case ModeReject:
+		verdict.Reject = true
+	case ModeFlag:
+		verdict.Flag = true
+	default:
+		out.WriteString(body[last:])
+		verdict.Body = out.String()
+	}
+	return verdict
+}
+
+func (w *WordList) banned(n string) bool {
+	if _, ok := w.words[n]; ok {
+		return true
+	}
+	_, ok := w.words[unleet(n)]
+	return ok
+}
+
+// wordSpans returns the byte offsets of each word in s. Zero-width and other
+// format characters count as part of a word so they can't be used to split
+// one.
+func wordSpans(s string) [][2]int {
+	spans := [][2]int{}
+	start := -1
+	for i, r := range s {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || unicode.Is(unicode.Cf, r)
+		if inWord && start < 0 {
+			start = i
+		}
+		if !inWord && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// LoadWordFile reads one word per line. Blank lines and lines starting with
+// # are ignored.
+func LoadWordFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
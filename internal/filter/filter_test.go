@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplaceMode(t *testing.T) {
+	w := NewWordList(ModeReplace, DefaultWords)
+	cases := map[string]string{
+		"This is a kerfuffle opinion I need to share with the world": "This is a **** opinion I need to share with the world",
+		"What a kerfuffle!":                 "What a ****!",
+		"KERFUFFLE, Sharbert and fornax.":   "****, **** and ****.",
+		"ｋｅｒｆｕｆｆｌｅ in fullwidth":            "**** in fullwidth",
+		"kérfüfflé with accents":            "**** with accents",
+		"ker\u200bfuffle hidden space":      "**** hidden space",
+		"kеrfufflе with cyrillic e":         "**** with cyrillic e",
+		"k3rfuffl3 in leet":                 "**** in leet",
+		"kerfuffles and sharbertz are fine": "kerfuffles and sharbertz are fine",
+	}
+	for in, want := range cases {
+		got := w.Check(in)
+		if got.Body != want {
+			t.Errorf("Check(%q).Body = %q, want %q", in, got.Body, want)
+		}
+		if got.Reject || got.Flag {
+			t.Errorf("Check(%q) should not reject or flag in replace mode", in)
+		}
+	}
+}
+
+func TestRejectAndFlagModes(t *testing.T) {
+	body := "a kerfuffle and a Fornax"
+	reject := NewWordList(ModeReject, DefaultWords).Check(body)
+	if !reject.Reject || reject.Body != body {
+		t.Errorf("Expected rejection with unchanged body, got %+v", reject)
+	}
+	flag := NewWordList(ModeFlag, DefaultWords).Check(body)
+	if !flag.Flag || flag.Body != body {
+		t.Errorf("Expected flag with unchanged body, got %+v", flag)
+	}
+	if !reflect.DeepEqual(flag.Matches, []string{"kerfuffle", "fornax"}) {
+		t.Errorf("Unexpected matches: %v", flag.Matches)
+	}
+	clean := NewWordList(ModeReject, DefaultWords).Check("all good here")
+	if clean.Reject || clean.Flag || len(clean.Matches) != 0 {
+		t.Errorf("Clean body should pass, got %+v", clean)
+	}
+}
+
+func TestSetWords(t *testing.T) {
+	w := NewWordList(ModeReplace, DefaultWords)
+	w.SetWords([]string{"Gadzooks"})
+	if got := w.Check("gadzooks kerfuffle").Body; got != "**** kerfuffle" {
+		t.Errorf("Word list not replaced, got %q", got)
+	}
+	if !reflect.DeepEqual(w.Words(), []string{"gadzooks"}) {
+		t.Errorf("Unexpected words: %v", w.Words())
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode(""); err != nil || m != ModeReplace {
+		t.Errorf("Expected replace by default, got %q %v", m, err)
+	}
+	if _, err := ParseMode("shout"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
@@ -0,0 +1,37 @@
+package healpers
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	hashtagRe = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]{1,64})`)
+	mentionRe = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)`)
+)
+
+// ExtractHashtags returns the distinct #tags in a chirp body, lowercased.
+func ExtractHashtags(body string) []string {
+	return extractDistinct(hashtagRe, body)
+}
+
+// ExtractMentions returns the distinct @mentions in a chirp body, lowercased.
+// Users are only identified by email for now, so a mention is @ followed by
+// an email address: "hi @alice@example.com".
+func ExtractMentions(body string) []string {
+	return extractDistinct(mentionRe, body)
+}
+
+func extractDistinct(re *regexp.Regexp, body string) []string {
+	found := []string{}
+	seen := map[string]bool{}
+	for _, match := range re.FindAllStringSubmatch(body, -1) {
+		value := strings.ToLower(match[1])
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		found = append(found, value)
+	}
+	return found
+}
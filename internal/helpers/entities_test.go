@@ -0,0 +1,38 @@
+package healpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := map[string][]string{
+		"no tags here":                    {},
+		"#Go is fun #golang":              {"go", "golang"},
+		"dupes #go #GO #go!":              {"go"},
+		"not a tag: foo#bar, &#39; ##two": {},
+		"unicode #café (#chirpy_dev)":     {"café", "chirpy_dev"},
+	}
+	for in, want := range cases {
+		got := ExtractHashtags(in)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractHashtags(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	cases := map[string][]string{
+		"hi @Alice@Example.com.":                 {"alice@example.com"},
+		"@bob@x.io and @bob@x.io again":          {"bob@x.io"},
+		"mail me at carol@x.io, not a mention":   {},
+		"handles like @dave are not users yet":   {},
+		"(@erin@sub.example.org) @frank@host.co": {"erin@sub.example.org", "frank@host.co"},
+	}
+	for in, want := range cases {
+		got := ExtractMentions(in)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractMentions(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
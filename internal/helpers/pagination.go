@@ -0,0 +1,189 @@
+package healpers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Cursor marks the last row of a page. Rows are ordered by (created_at, id)
+// so the id breaks ties between chirps created in the same instant. Search
+// results are ordered by relevance first and also carry the rank.
+type Cursor struct {
+	Rank      float32
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type PageParams struct {
+	Limit  int32
+	Desc   bool
+	Cursor *Cursor
+}
+
+type ChirpPage struct {
+	Chirps     Chirps `json:"chirps"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type FollowPage struct {
+	Users      []FollowUser `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+func EncodeCursor(c Cursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	if c.Rank != 0 {
+		raw += "|" + strconv.FormatFloat(float64(c.Rank), 'g', -1, 32)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+	cursor := Cursor{CreatedAt: createdAt, ID: id}
+	if len(parts) == 3 {
+		rank, err := strconv.ParseFloat(parts[2], 32)
+		if err != nil {
+			return Cursor{}, errors.New("invalid cursor")
+		}
+		cursor.Rank = float32(rank)
+	}
+	return cursor, nil
+}
+
+// ParsePageParams reads limit, cursor and sort from the query string.
+func ParsePageParams(query url.Values) (PageParams, error) {
+	page := PageParams{Limit: DefaultPageLimit}
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		if limit > MaxPageLimit {
+			limit = MaxPageLimit
+		}
+		page.Limit = int32(limit)
+	}
+	switch query.Get("sort") {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, errors.New("sort must be asc or desc")
+	}
+	if c := query.Get("cursor"); c != "" {
+		cursor, err := DecodeCursor(c)
+		if err != nil {
+			return page, err
+		}
+		page.Cursor = &cursor
+	}
+	return page, nil
+}
+
+// FetchLimit asks for one extra row so we can tell whether another page exists.
+func (p PageParams) FetchLimit() int32 {
+	return p.Limit + 1
+}
+
+func (p PageParams) CursorCreatedAt() sql.NullTime {
+	if p.Cursor == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true}
+}
+
+func (p PageParams) CursorRank() sql.NullFloat64 {
+	if p.Cursor == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: float64(p.Cursor.Rank), Valid: true}
+}
+
+func (p PageParams) CursorID() uuid.NullUUID {
+	if p.Cursor == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+}
+
+func ChirpFromDB(chirp database.Chirp) Chirp {
+	jsonChirp := Chirp{
+		Id:         chirp.ID,
+		Created_at: chirp.CreatedAt,
+		Updated_at: chirp.UpdatedAt,
+		Body:       chirp.Body,
+		User_id:    chirp.UserID,
+		Edited:     !chirp.UpdatedAt.Equal(chirp.CreatedAt),
+	}
+	if chirp.InReplyTo.Valid {
+		parent := chirp.InReplyTo.UUID
+		jsonChirp.In_reply_to = &parent
+	}
+	return jsonChirp
+}
+
+// NewChirpPage trims the extra row fetched by FetchLimit and turns it into
+// the next cursor.
+func NewChirpPage(chirps []database.Chirp, limit int32) ChirpPage {
+	page := ChirpPage{Chirps: Chirps{}}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		page.NextCursor = EncodeCursor(Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	for _, chirp := range chirps {
+		page.Chirps = append(page.Chirps, ChirpFromDB(chirp))
+	}
+	return page
+}
+
+// NextLink builds the Link header value pointing at the page after the one
+// requested by u, for endpoints that return a bare array.
+func NextLink(u *url.URL, cursor string) string {
+	query := u.Query()
+	query.Set("cursor", cursor)
+	next := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return "<" + next.String() + `>; rel="next"`
+}
+
+// NewFollowPage does for follower lists what NewChirpPage does for chirps,
+// keyed on the time the follow was created.
+func NewFollowPage(users []FollowUser, limit int32) FollowPage {
+	page := FollowPage{Users: []FollowUser{}}
+	if len(users) > int(limit) {
+		users = users[:limit]
+		last := users[len(users)-1]
+		page.NextCursor = EncodeCursor(Cursor{CreatedAt: last.Followed_at, ID: last.Id})
+	}
+	page.Users = append(page.Users, users...)
+	return page
+}
@@ -0,0 +1,116 @@
+package healpers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := Cursor{
+		CreatedAt: time.Date(2025, 4, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+	got, err := DecodeCursor(EncodeCursor(want))
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("Cursor mismatch: got %v, want %v", got, want)
+	}
+}
+
+func TestCursorRoundTripWithRank(t *testing.T) {
+	want := Cursor{Rank: 0.0607927, CreatedAt: time.Now().UTC(), ID: uuid.New()}
+	got, err := DecodeCursor(EncodeCursor(want))
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if got.Rank != want.Rank {
+		t.Errorf("Rank mismatch: got %v, want %v", got.Rank, want.Rank)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, c := range []string{"not-base64!", "Zm9v", EncodeCursor(Cursor{})[:4]} {
+		if _, err := DecodeCursor(c); err == nil {
+			t.Errorf("Expected error for cursor %q", c)
+		}
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	page, err := ParsePageParams(url.Values{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page.Limit != DefaultPageLimit || page.Desc || page.Cursor != nil {
+		t.Errorf("Unexpected defaults: %+v", page)
+	}
+
+	page, err = ParsePageParams(url.Values{"limit": {"1000"}, "sort": {"desc"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page.Limit != MaxPageLimit || !page.Desc {
+		t.Errorf("Expected capped limit and desc, got %+v", page)
+	}
+
+	for _, q := range []url.Values{{"limit": {"0"}}, {"limit": {"x"}}, {"sort": {"up"}}, {"cursor": {"bad"}}} {
+		if _, err := ParsePageParams(q); err == nil {
+			t.Errorf("Expected error for %v", q)
+		}
+	}
+}
+
+func TestNewChirpPage(t *testing.T) {
+	now := time.Now()
+	chirps := []database.Chirp{
+		{ID: uuid.New(), CreatedAt: now},
+		{ID: uuid.New(), CreatedAt: now.Add(time.Second)},
+		{ID: uuid.New(), CreatedAt: now.Add(2 * time.Second)},
+	}
+	page := NewChirpPage(chirps, 2)
+	if len(page.Chirps) != 2 {
+		t.Fatalf("Expected 2 chirps, got %d", len(page.Chirps))
+	}
+	cursor, err := DecodeCursor(page.NextCursor)
+	if err != nil {
+		t.Fatalf("Failed to decode next cursor: %v", err)
+	}
+	if cursor.ID != chirps[1].ID {
+		t.Errorf("Next cursor points at %v, want %v", cursor.ID, chirps[1].ID)
+	}
+
+	page = NewChirpPage(chirps, 3)
+	if page.NextCursor != "" {
+		t.Errorf("Expected no next cursor on last page, got %q", page.NextCursor)
+	}
+}
+
+func TestChirpFromDBEdited(t *testing.T) {
+	created := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: created, UpdatedAt: created}
+	if ChirpFromDB(chirp).Edited {
+		t.Error("Expected a fresh chirp not to be marked edited")
+	}
+	chirp.UpdatedAt = created.Add(time.Minute)
+	if !ChirpFromDB(chirp).Edited {
+		t.Error("Expected an updated chirp to be marked edited")
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	u, err := url.Parse("/api/chirps?sort=desc&limit=5&cursor=old")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	got := NextLink(u, "abc")
+	want := `</api/chirps?cursor=abc&limit=5&sort=desc>; rel="next"`
+	if got != want {
+		t.Errorf("NextLink = %q, want %q", got, want)
+	}
+}
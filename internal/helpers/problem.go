@@ -0,0 +1,178 @@
+package healpers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/CookieBorn/chirpy/internal/validate"
+)
+
+// Kind classifies an AppError and decides its HTTP status.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindRateLimited
+)
+
+var kindStatus = map[Kind]int{
+	KindInternal:     http.StatusInternalServerError,
+	KindInvalid:      http.StatusBadRequest,
+	KindValidation:   http.StatusUnprocessableEntity,
+	KindUnauthorized: http.StatusUnauthorized,
+	KindForbidden:    http.StatusForbidden,
+	KindNotFound:     http.StatusNotFound,
+	KindConflict:     http.StatusConflict,
+	KindRateLimited:  http.StatusTooManyRequests,
+}
+
+// Error codes sent as the code member of every problem. Clients switch on
+// these, so existing codes must never change meaning or spelling.
+const (
+	CodeInternal                = "internal_error"
+	CodeMalformedBody           = "malformed_body"
+	CodeInvalidParameter        = "invalid_parameter"
+	CodeValidationFailed        = "validation_failed"
+	CodeUnauthorized            = "unauthorized"
+	CodeInvalidCredentials      = "invalid_credentials"
+	CodeTokenExpired            = "token_expired"
+	CodeTokenInvalid            = "token_invalid"
+	CodeTokenReused             = "token_reused"
+	CodeForbidden               = "forbidden"
+	CodeAdminDisabled           = "admin_disabled"
+	CodeNotAuthor               = "not_author"
+	CodeEmailNotVerified        = "email_not_verified"
+	CodeEditWindowClosed        = "edit_window_closed"
+	CodeRestoreWindowClosed     = "restore_window_closed"
+	CodeNotFound                = "not_found"
+	CodeChirpNotFound           = "chirp_not_found"
+	CodeUserNotFound            = "user_not_found"
+	CodeSessionNotFound         = "session_not_found"
+	CodeEmailTaken              = "email_taken"
+	CodeEmailAlreadyVerified    = "email_already_verified"
+	CodeCannotFollowSelf        = "cannot_follow_self"
+	CodeDuplicateChirp          = "duplicate_chirp"
+	CodeInvalidResetToken       = "invalid_reset_token"
+	CodeInvalidVerificationLink = "invalid_verification_link"
+	CodeRateLimited             = "rate_limited"
+	CodeAccountLocked           = "account_locked"
+)
+
+// AppError is an error a handler wants the client to see. Detail is shown
+// to the client; Err is the underlying cause and is only logged.
+type AppError struct {
+	Kind   Kind
+	Code   string
+	Detail string
+	Fields map[string]string
+	Err    error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Status is the HTTP status for the error's kind.
+func (e *AppError) Status() int {
+	return kindStatus[e.Kind]
+}
+
+func Invalid(code, detail string) *AppError {
+	return &AppError{Kind: KindInvalid, Code: code, Detail: detail}
+}
+
+func Unauthorized(code, detail string) *AppError {
+	return &AppError{Kind: KindUnauthorized, Code: code, Detail: detail}
+}
+
+func Forbidden(code, detail string) *AppError {
+	return &AppError{Kind: KindForbidden, Code: code, Detail: detail}
+}
+
+func NotFound(code, detail string) *AppError {
+	return &AppError{Kind: KindNotFound, Code: code, Detail: detail}
+}
+
+func Conflict(code, detail string) *AppError {
+	return &AppError{Kind: KindConflict, Code: code, Detail: detail}
+}
+
+func RateLimited(code, detail string) *AppError {
+	return &AppError{Kind: KindRateLimited, Code: code, Detail: detail}
+}
+
+// Internal hides err from the client behind a generic message.
+func Internal(err error) *AppError {
+	return &AppError{Kind: KindInternal, Code: CodeInternal, Detail: "Internal server error", Err: err}
+}
+
+// Validation reports every invalid field at once so clients can show each
+// message next to its input.
+func Validation(errs validate.Errors) *AppError {
+	return &AppError{Kind: KindValidation, Code: CodeValidationFailed, Detail: "Validation failed", Fields: errs, Err: errs}
+}
+
+// MalformedBody is returned when the request body can't be decoded.
+func MalformedBody(err error) *AppError {
+	return &AppError{Kind: KindInvalid, Code: CodeMalformedBody, Detail: "Request body is not valid JSON", Err: err}
+}
+
+// AsAppError returns err as an *AppError, treating anything else as an
+// internal error.
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal(err)
+}
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// RespondWithProblem is the one place errors become responses. Headers the
+// caller set beforehand, such as Retry-After, are kept.
+func RespondWithProblem(w http.ResponseWriter, req *http.Request, err error) {
+	appErr := AsAppError(err)
+	status := appErr.Status()
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   appErr.Detail,
+		Instance: req.URL.Path,
+		Code:     appErr.Code,
+		Errors:   appErr.Fields,
+	}
+	dat, err := json.Marshal(problem)
+	if err != nil {
+		LoggerFromContext(req.Context()).Error("marshal problem failed", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(dat)
+}
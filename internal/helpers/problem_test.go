@@ -0,0 +1,78 @@
+package healpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CookieBorn/chirpy/internal/validate"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	problem := Problem{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Body is not JSON: %v", err)
+	}
+	return problem
+}
+
+func TestRespondWithProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/chirps/123", nil)
+	RespondWithProblem(rec, req, fmt.Errorf("get chirp: %w", NotFound(CodeChirpNotFound, "Chirp not found")))
+	if rec.Code != 404 {
+		t.Errorf("Status = %d, want 404", rec.Code)
+	}
+	problem := decodeProblem(t, rec)
+	want := Problem{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   404,
+		Detail:   "Chirp not found",
+		Instance: "/api/chirps/123",
+		Code:     CodeChirpNotFound,
+	}
+	if fmt.Sprint(problem) != fmt.Sprint(want) {
+		t.Errorf("Problem = %+v, want %+v", problem, want)
+	}
+}
+
+func TestRespondWithProblemHidesInternalErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/chirps", nil)
+	RespondWithProblem(rec, req, errors.New("pq: password authentication failed"))
+	if rec.Code != 500 {
+		t.Errorf("Status = %d, want 500", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "pq:") {
+		t.Errorf("Internal error leaked: %s", rec.Body)
+	}
+	if decodeProblem(t, rec).Code != CodeInternal {
+		t.Errorf("Expected %s", CodeInternal)
+	}
+}
+
+func TestRespondWithProblemValidation(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/users", nil)
+	RespondWithProblem(rec, req, Validation(validate.Errors{"email": "is required"}))
+	problem := decodeProblem(t, rec)
+	if rec.Code != 422 || problem.Code != CodeValidationFailed || problem.Errors["email"] != "is required" {
+		t.Errorf("Unexpected problem %d %+v", rec.Code, problem)
+	}
+}
+
+func TestKindStatuses(t *testing.T) {
+	for kind := KindInternal; kind <= KindRateLimited; kind++ {
+		if kindStatus[kind] == 0 {
+			t.Errorf("Kind %d has no status", kind)
+		}
+	}
+}
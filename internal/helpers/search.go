@@ -0,0 +1,46 @@
+package healpers
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// BuildTSQuery turns a user search string into a to_tsquery expression.
+// Quoted text becomes a phrase ("big red" -> big <-> red), a trailing *
+// makes a prefix match (chir* -> chir:*) and everything else is ANDed.
+// Only letters and digits reach Postgres so user input can't produce a
+// tsquery syntax error.
+func BuildTSQuery(q string) (string, error) {
+	terms := []string{}
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			words := searchWords(part)
+			if len(words) > 0 {
+				terms = append(terms, strings.Join(words, " <-> "))
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			prefix := strings.HasSuffix(field, "*")
+			words := searchWords(field)
+			if len(words) == 0 {
+				continue
+			}
+			if prefix {
+				words[len(words)-1] += ":*"
+			}
+			terms = append(terms, words...)
+		}
+	}
+	if len(terms) == 0 {
+		return "", errors.New("search query has no searchable terms")
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
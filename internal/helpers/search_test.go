@@ -0,0 +1,32 @@
+package healpers
+
+import "testing"
+
+func TestBuildTSQuery(t *testing.T) {
+	cases := map[string]string{
+		"hello":                   "hello",
+		"Hello World":             "hello & world",
+		`"big red" dog`:           "big <-> red & dog",
+		"chir*":                   "chir:*",
+		`it's "a phrase`:          "it & s & a <-> phrase",
+		"drop table; -- & | ! ()": "drop & table",
+	}
+	for in, want := range cases {
+		got, err := BuildTSQuery(in)
+		if err != nil {
+			t.Errorf("BuildTSQuery(%q) error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("BuildTSQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBuildTSQueryEmpty(t *testing.T) {
+	for _, in := range []string{"", "   ", `""`, "*** !!"} {
+		if _, err := BuildTSQuery(in); err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
+}
@@ -1,52 +1,113 @@
 package healpers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
-	"os"
-	"strings"
 	"time"
 
+	"github.com/CookieBorn/chirpy/internal/auth"
 	"github.com/CookieBorn/chirpy/internal/database"
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
+	"github.com/lib/pq"
 )
 
-type ReturnErr struct {
-	Err string `json:"error"`
-}
-
 type ValidRet struct {
 	Valid        bool   `json:"valid"`
 	Cleaned_body string `json:"cleaned_body"`
 }
 
 type Chirp struct {
+	Id          uuid.UUID  `json:"id"`
+	Created_at  time.Time  `json:"created_at"`
+	Updated_at  time.Time  `json:"updated_at"`
+	Body        string     `json:"body"`
+	User_id     uuid.UUID  `json:"user_id"`
+	In_reply_to *uuid.UUID `json:"in_reply_to"`
+	Reply_count int64      `json:"reply_count"`
+	Like_count  int64      `json:"like_count"`
+	Liked_by_me bool       `json:"liked_by_me"`
+	Edited      bool       `json:"edited"`
+}
+
+type Chirps []Chirp
+
+// ChirpRevision is a body a chirp had before it was edited, live from
+// Created_at until Replaced_at.
+type ChirpRevision struct {
+	Id          uuid.UUID `json:"id"`
+	Body        string    `json:"body"`
+	Created_at  time.Time `json:"created_at"`
+	Replaced_at time.Time `json:"replaced_at"`
+}
+
+type ThreadNode struct {
+	Chirp
+	Replies []*ThreadNode `json:"replies"`
+}
+
+type ChirpThread struct {
+	Ancestors Chirps      `json:"ancestors"`
+	Chirp     *ThreadNode `json:"chirp"`
+}
+
+type User struct {
+	Id             uuid.UUID `json:"id"`
+	Created_at     time.Time `json:"created_at"`
+	Updated_at     time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	Token          string    `json:"token"`
+	Refresh_token  string    `json:"refresh_token"`
+	Is_chirpy_red  bool      `json:"is_chirpy_red"`
+	Email_verified bool      `json:"email_verified"`
+}
+
+type FollowUser struct {
+	Id            uuid.UUID `json:"id"`
+	Is_chirpy_red bool      `json:"is_chirpy_red"`
+	Followed_at   time.Time `json:"followed_at"`
+}
+
+// Session is one login, i.e. one refresh token family.
+type Session struct {
+	Id           uuid.UUID `json:"id"`
+	User_agent   string    `json:"user_agent"`
+	Ip           string    `json:"ip"`
+	Created_at   time.Time `json:"created_at"`
+	Last_used_at time.Time `json:"last_used_at"`
+	Expires_at   time.Time `json:"expires_at"`
+	Current      bool      `json:"current"`
+}
+
+type TrendingTag struct {
+	Tag         string `json:"tag"`
+	Chirp_count int64  `json:"chirp_count"`
+}
+
+type TrendingTags struct {
+	Window string        `json:"window"`
+	Tags   []TrendingTag `json:"tags"`
+}
+
+type FlaggedChirp struct {
 	Id         uuid.UUID `json:"id"`
 	Created_at time.Time `json:"created_at"`
-	Updated_at time.Time `json:"updated_at"`
 	Body       string    `json:"body"`
 	User_id    uuid.UUID `json:"user_id"`
+	Matches    []string  `json:"matches"`
+	Flagged_at time.Time `json:"flagged_at"`
 }
 
-type Chirps []struct {
+type DeletedChirp struct {
 	Id         uuid.UUID `json:"id"`
 	Created_at time.Time `json:"created_at"`
-	Updated_at time.Time `json:"updated_at"`
 	Body       string    `json:"body"`
 	User_id    uuid.UUID `json:"user_id"`
-}
-
-type User struct {
-	Id            uuid.UUID `json:"id"`
-	Created_at    time.Time `json:"created_at"`
-	Updated_at    time.Time `json:"updated_at"`
-	Email         string    `json:"email"`
-	Token         string    `json:"token"`
-	Refresh_token string    `json:"refresh_token"`
-	Is_chirpy_red bool      `json:"is_chirpy_red"`
+	Deleted_at time.Time `json:"deleted_at"`
 }
 
 type PolkaWebHook struct {
@@ -56,60 +117,60 @@ type PolkaWebHook struct {
 	} `json:"data"`
 }
 
-func StringCleaner(s string) string {
-	slice := strings.Split(s, " ")
-	for int, sli := range slice {
-		if strings.ToLower(sli) == "kerfuffle" || strings.ToLower(sli) == "sharbert" || strings.ToLower(sli) == "fornax" {
-			slice[int] = "****"
-		}
+// DatabaseConnection opens the pool and checks that Postgres is reachable.
+// The caller owns the returned *sql.DB and must close it on shutdown.
+func DatabaseConnection(ctx context.Context, dbURL string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return nil, err
 	}
-	string := strings.Join(slice, " ")
-	return string
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func GetEnv(Title string) string {
-	godotenv.Load(".env")
-	dbURL := os.Getenv(Title)
-	return dbURL
-}
+type loggerKey struct{}
 
-func DatabaseConnection() *database.Queries {
-	dbURL := GetEnv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		fmt.Printf("Open connection error: %v", err)
-	}
-	dbQueries := database.New(db)
-	return dbQueries
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// ContextWithLogger attaches the request's logger so the responders can
+// report failures with its request_id.
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
 }
 
-func RespondWithError(w http.ResponseWriter, code int, msg string) {
-	errRet := ReturnErr{
-		Err: msg,
-	}
-	w.WriteHeader(code)
-	dat, err := json.Marshal(errRet)
-	if err != nil {
-		fmt.Printf("Marshal error: %v", err)
-		return
+// LoggerFromContext returns the logger set by ContextWithLogger, or one that
+// discards everything.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	l, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		return discardLogger
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(dat)
-	return
+	return l
 }
 
-func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+func RespondWithJSON(w http.ResponseWriter, req *http.Request, code int, payload interface{}) {
 	tru, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(400)
+		LoggerFromContext(req.Context()).Error("marshal JSON response failed", "error", err)
+		w.WriteHeader(500)
 		return
 	}
-	w.WriteHeader(code)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(tru)
 }
 
+// IsUniqueViolation reports whether err is Postgres refusing a duplicate
+// value for a UNIQUE column.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 func DecoderHealper(res http.ResponseWriter, req *http.Request, params any) (any, error) {
 	decoder := json.NewDecoder(req.Body)
 	err := decoder.Decode(&params)
@@ -119,16 +180,13 @@ func DecoderHealper(res http.ResponseWriter, req *http.Request, params any) (any
 	return params, nil
 }
 
-func CreateRefreshToken(usrId uuid.UUID, token string) (database.CreateRefreshTokenParams, error) {
-	emptyParam := database.CreateRefreshTokenParams{}
-	expIn, err := time.ParseDuration("1440h")
-	if err != nil {
-		return emptyParam, err
-	}
-	CreateParam := database.CreateRefreshTokenParams{
-		Token:     token,
+// CreateRefreshToken starts a new token family, one per login. Only the
+// token's digest is stored.
+func CreateRefreshToken(usrId uuid.UUID, token string, expIn time.Duration) database.CreateRefreshTokenParams {
+	return database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(token),
 		UserID:    usrId,
 		ExpiresAt: time.Now().Add(expIn),
+		FamilyID:  uuid.New(),
 	}
-	return CreateParam, err
 }
@@ -0,0 +1,30 @@
+package healpers
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	dup := fmt.Errorf("create user: %w", &pq.Error{Code: "23505"})
+	if !IsUniqueViolation(dup) {
+		t.Errorf("Wrapped 23505 should be a unique violation")
+	}
+	for _, err := range []error{nil, errors.New("23505"), &pq.Error{Code: "23503"}} {
+		if IsUniqueViolation(err) {
+			t.Errorf("%v is not a unique violation", err)
+		}
+	}
+}
+
+func TestRespondWithJSONSetsContentType(t *testing.T) {
+	rec := httptest.NewRecorder()
+	RespondWithJSON(rec, httptest.NewRequest("GET", "/", nil), 201, map[string]string{"ok": "yes"})
+	if rec.Code != 201 || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Got %d with Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,24 @@
+package healpers
+
+import "github.com/google/uuid"
+
+// BuildThread nests descendants under root. Descendants must be ordered so
+// that every chirp comes after the chirp it replies to, which holds when they
+// are sorted by created_at.
+func BuildThread(root Chirp, descendants Chirps) *ThreadNode {
+	rootNode := &ThreadNode{Chirp: root, Replies: []*ThreadNode{}}
+	nodes := map[uuid.UUID]*ThreadNode{root.Id: rootNode}
+	for _, chirp := range descendants {
+		if chirp.In_reply_to == nil {
+			continue
+		}
+		parent, ok := nodes[*chirp.In_reply_to]
+		if !ok {
+			continue
+		}
+		node := &ThreadNode{Chirp: chirp, Replies: []*ThreadNode{}}
+		parent.Replies = append(parent.Replies, node)
+		nodes[chirp.Id] = node
+	}
+	return rootNode
+}
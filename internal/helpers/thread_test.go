@@ -0,0 +1,25 @@
+package healpers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildThread(t *testing.T) {
+	root := Chirp{Id: uuid.New()}
+	reply := Chirp{Id: uuid.New(), In_reply_to: &root.Id}
+	nested := Chirp{Id: uuid.New(), In_reply_to: &reply.Id}
+	sibling := Chirp{Id: uuid.New(), In_reply_to: &root.Id}
+
+	tree := BuildThread(root, Chirps{reply, nested, sibling})
+	if len(tree.Replies) != 2 {
+		t.Fatalf("Expected 2 direct replies, got %d", len(tree.Replies))
+	}
+	if tree.Replies[0].Id != reply.Id || tree.Replies[1].Id != sibling.Id {
+		t.Errorf("Direct replies out of order")
+	}
+	if len(tree.Replies[0].Replies) != 1 || tree.Replies[0].Replies[0].Id != nested.Id {
+		t.Errorf("Nested reply not attached to its parent")
+	}
+}
@@ -0,0 +1,81 @@
+// Package mail sends the emails chirpy needs, such as password resets.
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes every message to a logger instead of sending it. The
+// body carries live reset and verification links, so it is only for local
+// development; config refuses it on any other platform.
+type LogMailer struct {
+	Logger *slog.Logger
+}
+
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	m.Logger.InfoContext(ctx, "email",
+		"from", msg.From,
+		"to", msg.To,
+		"subject", msg.Subject,
+		"body", msg.Body,
+	)
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in Dir, so tests and
+// developers can read what would have been sent.
+type FileMailer struct {
+	Dir string
+}
+
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	err := os.MkdirAll(m.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(msg.Format()), 0o600)
+}
+
+// Format renders the message with RFC 5322 headers.
+func (msg Message) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(msg.From))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.String()
+}
+
+// headerValue stops a value from smuggling in extra headers.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m := FileMailer{Dir: dir}
+	msg := Message{
+		From:    "chirpy@example.com",
+		To:      "user@example.com\r\nBcc: everyone@example.com",
+		Subject: "Reset your password",
+		Body:    "Line one\nLine two",
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected 2 messages, got %v (%v)", files, err)
+	}
+	dat, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	got := string(dat)
+	if !strings.Contains(got, "Subject: Reset your password\r\n") || !strings.HasSuffix(got, "Line one\r\nLine two") {
+		t.Errorf("Unexpected message:\n%s", got)
+	}
+	if strings.Contains(got, "\r\nBcc:") {
+		t.Errorf("Header injection got through:\n%s", got)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var logs bytes.Buffer
+	m := LogMailer{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Body: "token abc"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !strings.Contains(logs.String(), `"to":"user@example.com"`) || !strings.Contains(logs.String(), "token abc") {
+		t.Errorf("Message not logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics is every metric Chirpy exports, sharing one registry so the
+// /metrics endpoint and the HTML admin page read the same numbers.
+type Metrics struct {
+	Registry        *prometheus.Registry
+	HTTPRequests    *prometheus.CounterVec
+	HTTPDuration    *prometheus.HistogramVec
+	InFlight        prometheus.Gauge
+	DBQueryDuration *prometheus.HistogramVec
+	Logins          *prometheus.CounterVec
+	LoginLockouts   prometheus.Counter
+	Webhooks        *prometheus.CounterVec
+	FileserverHits  *HitCounter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_http_requests_total",
+			Help: "HTTP requests by route pattern and status.",
+		}, []string{"route", "status"}),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "chirpy_http_request_duration_seconds",
+			Help: "HTTP request latency by route pattern.",
+		}, []string{"route"}),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "chirpy_http_requests_in_flight",
+			Help: "HTTP requests currently being served.",
+		}),
+		DBQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "chirpy_db_query_duration_seconds",
+			Help: "Database query latency by sqlc query name.",
+		}, []string{"query"}),
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_logins_total",
+			Help: "Login attempts by result.",
+		}, []string{"result"}),
+		LoginLockouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chirpy_login_lockouts_total",
+			Help: "Accounts locked after repeated failed logins.",
+		}),
+		Webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_polka_webhooks_total",
+			Help: "Polka webhooks by outcome.",
+		}, []string{"outcome"}),
+		FileserverHits: &HitCounter{},
+	}
+	m.Registry.MustRegister(
+		m.HTTPRequests,
+		m.HTTPDuration,
+		m.InFlight,
+		m.DBQueryDuration,
+		m.Logins,
+		m.LoginLockouts,
+		m.Webhooks,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "chirpy_fileserver_hits_total",
+			Help: "Requests served from /app/.",
+		}, func() float64 { return float64(m.FileserverHits.Value()) }),
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// HitCounter counts fileserver hits. Unlike a Prometheus counter it can be
+// read and reset, which the admin page and /admin/reset need.
+type HitCounter struct {
+	n atomic.Int64
+}
+
+func (h *HitCounter) Inc() {
+	h.n.Add(1)
+}
+
+func (h *HitCounter) Value() int64 {
+	return h.n.Load()
+}
+
+func (h *HitCounter) Reset() {
+	h.n.Store(0)
+}
+
+// DB wraps a *sql.DB and times every query by its sqlc name. It satisfies
+// database.DBTX so it can be handed straight to database.New.
+type DB struct {
+	*sql.DB
+	duration *prometheus.HistogramVec
+}
+
+func (m *Metrics) InstrumentDB(db *sql.DB) *DB {
+	return &DB{DB: db, duration: m.DBQueryDuration}
+}
+
+func (db *DB) observe(query string, start time.Time) {
+	db.duration.WithLabelValues(QueryName(query)).Observe(time.Since(start).Seconds())
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer db.observe(query, time.Now())
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer db.observe(query, time.Now())
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer db.observe(query, time.Now())
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+// QueryName pulls the name out of the "-- name: GetChirp :one" comment sqlc
+// puts at the top of every query.
+func QueryName(query string) string {
+	line, _, _ := strings.Cut(query, "\n")
+	rest, ok := strings.CutPrefix(line, "-- name: ")
+	if !ok {
+		return "unknown"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.HTTPRequests.WithLabelValues("GET /api/chirps", "200").Add(3)
+	m.FileserverHits.Inc()
+	m.FileserverHits.Inc()
+
+	res := httptest.NewRecorder()
+	m.Handler().ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	body := res.Body.String()
+	for _, want := range []string{
+		`chirpy_http_requests_total{route="GET /api/chirps",status="200"} 3`,
+		"chirpy_fileserver_hits_total 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in output:\n%s", want, body)
+		}
+	}
+	m.FileserverHits.Reset()
+	if m.FileserverHits.Value() != 0 {
+		t.Errorf("Reset did not zero the counter")
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	cases := map[string]string{
+		"-- name: GetChirp :one\nSELECT 1": "GetChirp",
+		"-- name: Reset :exec\n":           "Reset",
+		"SELECT 1":                         "unknown",
+	}
+	for in, want := range cases {
+		if got := QueryName(in); got != want {
+			t.Errorf("QueryName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
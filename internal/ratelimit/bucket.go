@@ -0,0 +1,121 @@
+// Package ratelimit implements token bucket rate limiting.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped so the map doesn't
+// grow with every address that ever connected.
+const sweepInterval = time.Minute
+
+// Store keeps token buckets. Each bucket holds up to limit tokens and
+// refills limit tokens per period; a request spends one token.
+// MemoryStore is per process; a shared backend can implement Store to
+// enforce limits across instances.
+type Store interface {
+	Take(ctx context.Context, key string, limit int, per time.Duration) (Result, error)
+}
+
+// Result describes a bucket after a Take.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next token when Allowed is false.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// MemoryStore is a Store that lives in process memory.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	burst  float64
+	rate   float64 // tokens per second
+	last   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit int, per time.Duration) (Result, error) {
+	return s.take(key, limit, per), nil
+}
+
+func (s *MemoryStore) take(key string, limit int, per time.Duration) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+	burst, rate := float64(limit), float64(limit)/per.Seconds()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+	// A changed limit, e.g. after an upgrade, applies from now on.
+	b.burst, b.rate = burst, rate
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / rate)
+	return res
+}
+
+// sweep drops buckets that have refilled completely; they are
+// indistinguishable from new ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Limiter applies one fixed limit to every key, backed by its own
+// MemoryStore.
+type Limiter struct {
+	store *MemoryStore
+	limit int
+	per   time.Duration
+}
+
+// NewLimiter allows limit requests per period per key, all of which may
+// arrive at once.
+func NewLimiter(limit int, per time.Duration) *Limiter {
+	return &Limiter{store: NewMemoryStore(), limit: limit, per: per}
+}
+
+// Allow spends a token for key. When the bucket is empty it returns false
+// and how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	res := l.store.take(key, l.limit, l.per)
+	return res.Allowed, res.RetryAfter
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(3, time.Minute)
+	l.store.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	ok, wait := l.Allow("1.2.3.4")
+	if ok {
+		t.Fatal("Fourth request should be limited")
+	}
+	if wait != 20*time.Second {
+		t.Errorf("Expected a 20s wait, got %v", wait)
+	}
+	if ok, _ := l.Allow("5.6.7.8"); !ok {
+		t.Error("Other keys have their own bucket")
+	}
+
+	now = now.Add(20 * time.Second)
+	if ok, _ := l.Allow("1.2.3.4"); !ok {
+		t.Error("A token should have refilled")
+	}
+	if ok, _ := l.Allow("1.2.3.4"); ok {
+		t.Error("Only one token should have refilled")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	s.Take(context.Background(), "a", 1, time.Second)
+	now = now.Add(2 * sweepInterval)
+	s.Take(context.Background(), "b", 1, time.Second)
+	if _, ok := s.buckets["a"]; ok {
+		t.Error("Idle bucket should have been swept")
+	}
+}
+
+func TestMemoryStoreResult(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	res, _ := s.Take(ctx, "user", 2, time.Minute)
+	if !res.Allowed || res.Limit != 2 || res.Remaining != 1 || res.Reset != 30*time.Second {
+		t.Errorf("Unexpected first result %+v", res)
+	}
+	s.Take(ctx, "user", 2, time.Minute)
+	res, _ = s.Take(ctx, "user", 2, time.Minute)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 30*time.Second || res.Reset != time.Minute {
+		t.Errorf("Unexpected limited result %+v", res)
+	}
+
+	// A higher limit, say after an upgrade, takes effect on the same bucket.
+	res, _ = s.Take(ctx, "user", 10, time.Minute)
+	if res.Allowed || res.Limit != 10 {
+		t.Errorf("An empty bucket stays empty when the limit rises, got %+v", res)
+	}
+	now = now.Add(6 * time.Second)
+	if res, _ = s.Take(ctx, "user", 10, time.Minute); !res.Allowed {
+		t.Errorf("Bucket should refill at the new rate, got %+v", res)
+	}
+}
@@ -0,0 +1,125 @@
+// Package validate checks request input before it reaches the database.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxEmailLength is the longest address SMTP can deliver to.
+	MaxEmailLength = 254
+	// MinPasswordLength is counted in characters.
+	MinPasswordLength = 8
+	// MaxPasswordLength is counted in bytes, because bcrypt ignores
+	// everything after the 72nd.
+	MaxPasswordLength = 72
+	// MaxChirpLength is counted in characters.
+	MaxChirpLength = 140
+)
+
+// Errors maps request fields to what is wrong with them. The zero value is
+// ready to use.
+type Errors map[string]string
+
+// Add records err against field, keeping the first problem found.
+func (e *Errors) Add(field string, err error) {
+	if err == nil {
+		return
+	}
+	if *e == nil {
+		*e = Errors{}
+	}
+	if _, ok := (*e)[field]; !ok {
+		(*e)[field] = err.Error()
+	}
+}
+
+// Err returns e as an error, or nil if nothing was added.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	parts := make([]string, 0, len(e))
+	for _, f := range fields {
+		parts = append(parts, f+": "+e[f])
+	}
+	return strings.Join(parts, "; ")
+}
+
+// NormalizeEmail trims and case-folds an address so the UNIQUE constraint
+// on users.email can't be dodged by changing case. Use it on every email
+// that is stored or looked up.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Email checks that email is a bare address and returns it normalized.
+func Email(email string) (string, error) {
+	email = NormalizeEmail(email)
+	if email == "" {
+		return "", errors.New("is required")
+	}
+	if len(email) > MaxEmailLength {
+		return "", fmt.Errorf("must be at most %d characters", MaxEmailLength)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("must be a valid email address")
+	}
+	return email, nil
+}
+
+// Password enforces the password policy: a length bcrypt can hash in full,
+// at least one letter and one other character, and not the email itself.
+func Password(password, email string) error {
+	if password == "" {
+		return errors.New("is required")
+	}
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return fmt.Errorf("must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("must be at most %d bytes", MaxPasswordLength)
+	}
+	var letter, other bool
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			letter = true
+		} else {
+			other = true
+		}
+	}
+	if !letter || !other {
+		return errors.New("must mix letters with digits or symbols")
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		return errors.New("must not be your email address")
+	}
+	return nil
+}
+
+// ChirpBody checks the length of a chirp.
+func ChirpBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("is required")
+	}
+	if utf8.RuneCountInString(body) > MaxChirpLength {
+		return fmt.Errorf("must be at most %d characters", MaxChirpLength)
+	}
+	return nil
+}
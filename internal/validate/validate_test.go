@@ -0,0 +1,74 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEmail(t *testing.T) {
+	got, err := Email("  Alice@Example.COM ")
+	if err != nil || got != "alice@example.com" {
+		t.Errorf("Email = %q, %v", got, err)
+	}
+	bad := []string{
+		"",
+		"alice",
+		"alice@",
+		"Alice <alice@example.com>",
+		"alice@example.com, bob@example.com",
+		strings.Repeat("a", MaxEmailLength) + "@example.com",
+	}
+	for _, email := range bad {
+		if _, err := Email(email); err == nil {
+			t.Errorf("Expected %q to be rejected", email)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	if err := Password("correct horse 9", "alice@example.com"); err != nil {
+		t.Errorf("Good password rejected: %v", err)
+	}
+	bad := []string{
+		"",
+		"short1",
+		"onlyletters",
+		"1234567890",
+		strings.Repeat("a1", 40),
+		"Alice@Example.com",
+	}
+	for _, p := range bad {
+		if err := Password(p, "alice@example.com"); err == nil {
+			t.Errorf("Expected %q to be rejected", p)
+		}
+	}
+}
+
+func TestChirpBody(t *testing.T) {
+	if err := ChirpBody(strings.Repeat("é", MaxChirpLength)); err != nil {
+		t.Errorf("140 characters rejected: %v", err)
+	}
+	for _, body := range []string{"", "   ", strings.Repeat("a", MaxChirpLength+1)} {
+		if err := ChirpBody(body); err == nil {
+			t.Errorf("Expected %q to be rejected", body)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	errs.Add("email", nil)
+	if errs.Err() != nil {
+		t.Fatalf("No problems should mean no error")
+	}
+	errs.Add("password", errors.New("is required"))
+	errs.Add("password", errors.New("is too short"))
+	errs.Add("email", errors.New("must be a valid email address"))
+	if errs["password"] != "is required" {
+		t.Errorf("First problem should be kept, got %q", errs["password"])
+	}
+	if errs.Err().Error() != "email: must be a valid email address; password: is required" {
+		t.Errorf("Unexpected message %q", errs.Err())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+func (cfg *ApiConfig) postLike(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	chirpID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	_, err = cfg.getChirp(req.Context(), chirpID)
+	if err != nil {
+		return err
+	}
+	err = cfg.DB.LikeChirp(req.Context(), database.LikeChirpParams{
+		UserID:  usrID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("like chirp: %w", err))
+	}
+	res.WriteHeader(204)
+	return nil
+}
+
+func (cfg *ApiConfig) deleteLike(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	chirpID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	err = cfg.DB.UnlikeChirp(req.Context(), database.UnlikeChirpParams{
+		UserID:  usrID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("unlike chirp: %w", err))
+	}
+	res.WriteHeader(204)
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+)
+
+// loginFailureWindow is how long a failed login counts towards a lockout.
+const loginFailureWindow = 24 * time.Hour
+
+// loginFailurePurgeInterval is how often stale login failures are deleted.
+const loginFailurePurgeInterval = time.Hour
+
+// loginThrottled applies the per-IP and per-account token buckets. They run
+// before the user lookup and bcrypt, so hammering the endpoint is cheap for
+// us and slow for the caller. email must already be normalized.
+func (cfg *ApiConfig) loginThrottled(res http.ResponseWriter, req *http.Request, email string) error {
+	if ok, wait := cfg.LoginIPLimiter.Allow(clientIP(req)); !ok {
+		cfg.Metrics.Logins.WithLabelValues("rate_limited_ip").Inc()
+		return tooManyRequests(res, wait, healpers.CodeRateLimited, "Too many login attempts")
+	}
+	if ok, wait := cfg.LoginAccountLimiter.Allow(email); !ok {
+		cfg.Metrics.Logins.WithLabelValues("rate_limited_account").Inc()
+		return tooManyRequests(res, wait, healpers.CodeRateLimited, "Too many login attempts")
+	}
+	return nil
+}
+
+// loginLocked returns an error if email is serving a lockout. Failures are
+// kept per email whether or not it has an account, so a lockout says
+// nothing about which emails are registered.
+func (cfg *ApiConfig) loginLocked(res http.ResponseWriter, req *http.Request, email string) error {
+	failures, err := cfg.DB.GetLoginFailures(req.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get login failures: %w", err))
+	}
+	if failures.LockedUntil.Valid && time.Now().Before(failures.LockedUntil.Time) {
+		cfg.Metrics.Logins.WithLabelValues("locked_out").Inc()
+		return tooManyRequests(res, time.Until(failures.LockedUntil.Time), healpers.CodeAccountLocked, "Account temporarily locked")
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login for email and locks it once the
+// failures pass the threshold.
+func (cfg *ApiConfig) recordLoginFailure(req *http.Request, email string) {
+	now := time.Now()
+	failures, err := cfg.DB.RecordLoginFailure(req.Context(), database.RecordLoginFailureParams{
+		Email:       email,
+		FailedAt:    now,
+		ResetBefore: now.Add(-loginFailureWindow),
+	})
+	if err != nil {
+		cfg.logger(req).Error("record login failure failed", "error", err)
+		return
+	}
+	lockout := cfg.lockoutFor(failures.FailedCount)
+	if lockout == 0 {
+		return
+	}
+	err = cfg.DB.LockLogin(req.Context(), database.LockLoginParams{
+		Email:       email,
+		LockedUntil: sql.NullTime{Time: now.Add(lockout), Valid: true},
+	})
+	if err != nil {
+		cfg.logger(req).Error("lock login failed", "error", err)
+		return
+	}
+	cfg.Metrics.LoginLockouts.Inc()
+	cfg.logger(req).Warn("login locked after failed logins",
+		"email", email,
+		"ip", clientIP(req),
+		"failures", failures.FailedCount,
+		"lockout", lockout.String(),
+	)
+}
+
+// lockoutFor is zero below the threshold, then starts at the base lockout
+// and doubles with every further failure, up to the maximum.
+func (cfg *ApiConfig) lockoutFor(failures int32) time.Duration {
+	extra := int(failures) - cfg.Config.LoginLockoutThreshold
+	if extra < 0 {
+		return 0
+	}
+	lockout := cfg.Config.LoginLockoutBase
+	for i := 0; i < extra && lockout < cfg.Config.LoginLockoutMax; i++ {
+		lockout *= 2
+	}
+	return min(lockout, cfg.Config.LoginLockoutMax)
+}
+
+// purgeLoginFailures deletes failures that no longer count and lockouts
+// that have ended, every purge interval until ctx is done. Failures are kept
+// for unknown emails too, so without this the table only grows.
+func (cfg *ApiConfig) purgeLoginFailures(ctx context.Context) {
+	ticker := time.NewTicker(loginFailurePurgeInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		_, err := cfg.DB.PurgeLoginFailures(ctx, database.PurgeLoginFailuresParams{
+			ResetBefore: now.Add(-loginFailureWindow),
+			Now:         now,
+		})
+		if err != nil && ctx.Err() == nil {
+			cfg.Logger.Error("purge login failures failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/config"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/CookieBorn/chirpy/internal/metrics"
+	"github.com/CookieBorn/chirpy/internal/ratelimit"
+	"github.com/CookieBorn/chirpy/internal/validate"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLockoutFor(t *testing.T) {
+	cfg := &ApiConfig{Config: config.Config{
+		LoginLockoutThreshold: 3,
+		LoginLockoutBase:      time.Minute,
+		LoginLockoutMax:       10 * time.Minute,
+	}}
+	cases := map[int32]time.Duration{
+		1:  0,
+		2:  0,
+		3:  time.Minute,
+		4:  2 * time.Minute,
+		5:  4 * time.Minute,
+		6:  8 * time.Minute,
+		7:  10 * time.Minute,
+		40: 10 * time.Minute,
+	}
+	for failures, want := range cases {
+		if got := cfg.lockoutFor(failures); got != want {
+			t.Errorf("lockoutFor(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestLoginThrottled(t *testing.T) {
+	cfg := &ApiConfig{
+		Metrics:             metrics.New(),
+		LoginIPLimiter:      ratelimit.NewLimiter(3, time.Minute),
+		LoginAccountLimiter: ratelimit.NewLimiter(2, time.Minute),
+	}
+	attempt := func(ip, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/login", nil)
+		req.RemoteAddr = ip + ":5555"
+		rec := httptest.NewRecorder()
+		if err := cfg.loginThrottled(rec, req, validate.NormalizeEmail(email)); err != nil {
+			healpers.RespondWithProblem(rec, req, err)
+		} else {
+			rec.WriteHeader(200)
+		}
+		return rec
+	}
+
+	attempt("10.0.0.1", "a@example.com")
+	attempt("10.0.0.2", " A@example.com")
+	rec := attempt("10.0.0.3", "a@EXAMPLE.com")
+	if rec.Code != 429 || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected 429 with Retry-After 30 for the account, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	attempt("10.0.0.9", "b@example.com")
+	attempt("10.0.0.9", "c@example.com")
+	attempt("10.0.0.9", "d@example.com")
+	rec = attempt("10.0.0.9", "e@example.com")
+	if rec.Code != 429 || rec.Header().Get("Retry-After") != "20" {
+		t.Errorf("Expected 429 with Retry-After 20 for the IP, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if got := testutil.ToFloat64(cfg.Metrics.Logins.WithLabelValues("rate_limited_ip")); got != 1 {
+		t.Errorf("Expected 1 IP rate limited login, got %v", got)
+	}
+	if got := testutil.ToFloat64(cfg.Metrics.Logins.WithLabelValues("rate_limited_account")); got != 1 {
+		t.Errorf("Expected 1 account rate limited login, got %v", got)
+	}
+}
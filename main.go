@@ -1,157 +1,331 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"sort"
-	"strconv"
+	"os/signal"
 	"strings"
-	"sync/atomic"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/config"
 	"github.com/CookieBorn/chirpy/internal/database"
+	"github.com/CookieBorn/chirpy/internal/filter"
 	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/CookieBorn/chirpy/internal/mail"
+	"github.com/CookieBorn/chirpy/internal/metrics"
+	"github.com/CookieBorn/chirpy/internal/ratelimit"
+	"github.com/CookieBorn/chirpy/internal/validate"
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
 
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	dbQueries := healpers.DatabaseConnection()
+	err := run(os.Args[1:])
+	if err != nil {
+		slog.Error("chirpy stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server and blocks until it fails or receives SIGINT or
+// SIGTERM, in which case it drains in-flight requests before returning.
+func run(args []string) error {
+	conf, err := config.Load(args)
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	filterMode, err := filter.ParseMode(conf.FilterMode)
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	logger, err := conf.NewLogger(os.Stderr)
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	slog.SetDefault(logger)
+	signingKeys := []*auth.SigningKey{}
+	for _, path := range conf.JWTKeyFiles {
+		key, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return fmt.Errorf("config error: %w", err)
+		}
+		signingKeys = append(signingKeys, key)
+	}
+	keys, err := auth.NewKeySet(signingKeys, conf.HMACSecret())
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	keys.Audience = conf.JWTAudience
+	keys.Leeway = conf.JWTLeeway
+	keys.Logger = logger
+	db, err := healpers.DatabaseConnection(context.Background(), conf.DBURL)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer db.Close()
+	chirpyMetrics := metrics.New()
 	apiC := ApiConfig{
-		DB:        dbQueries,
-		JWTSecret: healpers.GetEnv("JWT_SECRET"),
-		PolkaKey:  healpers.GetEnv("POLKA_KEY"),
+		DB:      database.New(chirpyMetrics.InstrumentDB(db)),
+		Metrics: chirpyMetrics,
+		Config:  conf,
+		Keys:    keys,
+		Logger:  logger,
+		Filter:  filter.NewWordList(filterMode, filter.DefaultWords),
+		Mailer:  conf.NewMailer(logger),
+
+		LoginIPLimiter:      ratelimit.NewLimiter(conf.LoginIPLimit, time.Minute),
+		LoginAccountLimiter: ratelimit.NewLimiter(conf.LoginAccountLimit, time.Minute),
+		ResetEmailLimiter:   ratelimit.NewLimiter(conf.PasswordResetLimit, time.Hour),
+		RateLimits:          ratelimit.NewMemoryStore(),
+		redUsers:            newRedCache(),
+	}
+	err = apiC.loadFilterWords(context.Background())
+	if err != nil {
+		logger.Error("load filter words failed", "error", err)
 	}
-	apiC.FileserverHits.Store(0)
 	servMux := http.NewServeMux()
 	servMux.Handle("/app/", apiC.middlewareMetricsInc(http.FileServer(http.Dir("."))))
 	servMux.HandleFunc("GET /api/healthz", ReadinessHandeler)
 	servMux.HandleFunc("GET /admin/metrics", apiC.metricHandle)
-	servMux.HandleFunc("POST /admin/reset", apiC.metricReset)
-	servMux.HandleFunc("POST /api/chirps", apiC.postHandle)
-	servMux.HandleFunc("POST /api/users", apiC.createUserHandle)
-	servMux.HandleFunc("GET /api/chirps", apiC.getChirpsHandle)
-	servMux.HandleFunc("GET /api/chirps/", apiC.getChirpHandle)
-	servMux.HandleFunc("POST /api/login", apiC.postLoginHandle)
-	servMux.HandleFunc("POST /api/refresh", apiC.postRefres)
-	servMux.HandleFunc("POST /api/revoke", apiC.postRevoke)
-	servMux.HandleFunc("PUT /api/users", apiC.putUserUpdate)
-	servMux.HandleFunc("DELETE /api/chirps/", apiC.deleteChirp)
-	servMux.HandleFunc("POST /api/polka/webhooks", apiC.postPolkaWebhook)
+	servMux.Handle("GET /metrics", apiC.Metrics.Handler())
+	servMux.HandleFunc("GET /.well-known/jwks.json", apiC.handle(apiC.getJWKS))
+	servMux.HandleFunc("POST /admin/reset", apiC.handle(apiC.metricReset))
+	servMux.HandleFunc("GET /admin/filter/words", apiC.handle(apiC.getFilterWords))
+	servMux.HandleFunc("POST /admin/filter/words", apiC.handle(apiC.postFilterWord))
+	servMux.HandleFunc("DELETE /admin/filter/words/{word}", apiC.handle(apiC.deleteFilterWord))
+	servMux.HandleFunc("GET /admin/filter/flags", apiC.handle(apiC.getFlaggedChirps))
+	servMux.HandleFunc("GET /admin/chirps/deleted", apiC.handle(apiC.getDeletedChirps))
+	servMux.HandleFunc("POST /api/chirps", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.postHandle))))
+	servMux.HandleFunc("POST /api/users", apiC.RateLimitWrite(apiC.handle(apiC.createUserHandle)))
+	servMux.HandleFunc("GET /api/chirps", apiC.OptionalAuth(apiC.RateLimitRead(apiC.handle(apiC.getChirpsHandle))))
+	servMux.HandleFunc("GET /api/chirps/", apiC.OptionalAuth(apiC.RateLimitRead(apiC.handle(apiC.getChirpHandle))))
+	servMux.HandleFunc("GET /api/chirps/search", apiC.OptionalAuth(apiC.RateLimitRead(apiC.handle(apiC.searchChirpsHandle))))
+	servMux.HandleFunc("PUT /api/chirps/{id}", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.putChirp))))
+	servMux.HandleFunc("POST /api/chirps/{id}/restore", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.postRestoreChirp))))
+	servMux.HandleFunc("GET /api/chirps/{id}/revisions", apiC.OptionalAuth(apiC.RateLimitRead(apiC.handle(apiC.getChirpRevisions))))
+	servMux.HandleFunc("GET /api/chirps/{id}/thread", apiC.OptionalAuth(apiC.RateLimitRead(apiC.handle(apiC.getChirpThread))))
+	servMux.HandleFunc("POST /api/chirps/{id}/like", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.postLike))))
+	servMux.HandleFunc("DELETE /api/chirps/{id}/like", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.deleteLike))))
+	servMux.HandleFunc("POST /api/login", apiC.handle(apiC.postLoginHandle))
+	servMux.HandleFunc("POST /api/refresh", apiC.handle(apiC.postRefres))
+	servMux.HandleFunc("POST /api/revoke", apiC.handle(apiC.postRevoke))
+	servMux.HandleFunc("POST /api/password/forgot", apiC.RateLimitWrite(apiC.handle(apiC.postForgotPassword)))
+	servMux.HandleFunc("POST /api/password/reset", apiC.RateLimitWrite(apiC.handle(apiC.postResetPassword)))
+	servMux.HandleFunc("GET /api/users/verify", apiC.RateLimitRead(apiC.handle(apiC.getVerifyEmail)))
+	servMux.HandleFunc("POST /api/users/verify/resend", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.postResendVerification))))
+	servMux.HandleFunc("PUT /api/users", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.putUserUpdate))))
+	servMux.HandleFunc("DELETE /api/chirps/", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.deleteChirp))))
+	servMux.HandleFunc("POST /api/polka/webhooks", apiC.handle(apiC.postPolkaWebhook))
+	servMux.HandleFunc("POST /api/users/{id}/follow", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.postFollow))))
+	servMux.HandleFunc("DELETE /api/users/{id}/follow", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.deleteFollow))))
+	servMux.HandleFunc("GET /api/users/{id}/followers", apiC.RequireAuth(apiC.RateLimitRead(apiC.handle(apiC.getFollowers))))
+	servMux.HandleFunc("GET /api/users/{id}/following", apiC.RequireAuth(apiC.RateLimitRead(apiC.handle(apiC.getFollowing))))
+	servMux.HandleFunc("GET /api/timeline", apiC.RequireAuth(apiC.RateLimitRead(apiC.handle(apiC.getTimeline))))
+	servMux.HandleFunc("GET /api/tags/trending", apiC.OptionalAuth(apiC.RateLimitRead(apiC.handle(apiC.getTrendingTags))))
+	servMux.HandleFunc("GET /api/tags/{tag}/chirps", apiC.OptionalAuth(apiC.RateLimitRead(apiC.handle(apiC.getTagChirps))))
+	servMux.HandleFunc("GET /api/users/me/mentions", apiC.RequireAuth(apiC.RateLimitRead(apiC.handle(apiC.getMyMentions))))
+	servMux.HandleFunc("GET /api/sessions", apiC.RequireAuth(apiC.RateLimitRead(apiC.handle(apiC.getSessions))))
+	servMux.HandleFunc("DELETE /api/sessions/{id}", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.deleteSession))))
+	servMux.HandleFunc("DELETE /api/sessions", apiC.RequireAuth(apiC.RateLimitWrite(apiC.handle(apiC.deleteOtherSessions))))
 	http.StripPrefix("app/", servMux)
 	servStruct := http.Server{
-		Addr:    ":8081",
-		Handler: servMux,
-	}
-	err := servStruct.ListenAndServe()
-	if err != nil {
-		fmt.Printf("%v", err)
-	}
+		Addr:              conf.Addr,
+		Handler:           apiC.middlewareRequestID(apiC.middlewareAccessLog(apiC.middlewareMetrics(apiC.middlewareRateLimitIP(servMux)))),
+		ReadTimeout:       conf.ReadTimeout,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go apiC.purgeDeletedChirps(ctx)
+	go apiC.purgeLoginFailures(ctx)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- servStruct.ListenAndServe()
+	}()
+	logger.Info("server listening", "addr", conf.Addr)
+	select {
+	case err = <-serveErr:
+		return fmt.Errorf("server error: %w", err)
+	case <-ctx.Done():
+	}
+	// Stop accepting connections and give in-flight requests the drain
+	// period to finish before the database pool is closed.
+	logger.Info("shutting down", "drain", conf.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	err = servStruct.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("shutdown error: %w", err)
+	}
+	apiC.background.Wait()
+	return nil
 }
 
 func ReadinessHandeler(res http.ResponseWriter, req *http.Request) {
-	req.Header.Set("Content-Type", "text/plain")
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	res.WriteHeader(200)
 	write := []byte("OK")
-	int, err := res.Write(write)
+	_, err := res.Write(write)
+	if err != nil {
+		healpers.LoggerFromContext(req.Context()).Error("write response failed", "error", err)
+	}
+}
+
+// getJWKS publishes the public keys other services use to verify access
+// tokens.
+func (cfg *ApiConfig) getJWKS(res http.ResponseWriter, req *http.Request) error {
+	dat, err := cfg.Keys.JWKS()
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("build JWKS: %w", err))
+	}
+	res.Header().Set("Content-Type", "application/jwk-set+json")
+	res.Header().Set("Cache-Control", "public, max-age=300")
+	res.WriteHeader(200)
+	_, err = res.Write(dat)
 	if err != nil {
-		fmt.Printf("%d: %v", int, err)
+		cfg.logger(req).Error("write response failed", "error", err)
 	}
+	return nil
 }
 
 type ApiConfig struct {
-	FileserverHits atomic.Int32
-	DB             *database.Queries
-	JWTSecret      string
-	PolkaKey       string
+	DB      *database.Queries
+	Config  config.Config
+	Keys    *auth.KeySet
+	Metrics *metrics.Metrics
+	Logger  *slog.Logger
+	Filter  filter.ContentFilter
+	Mailer  mail.Mailer
+
+	LoginIPLimiter      *ratelimit.Limiter
+	LoginAccountLimiter *ratelimit.Limiter
+	ResetEmailLimiter   *ratelimit.Limiter
+	RateLimits          ratelimit.Store
+	redUsers            *redCache
+
+	// background tracks work handlers leave running after they respond, so
+	// shutdown can wait for it before closing the database.
+	background sync.WaitGroup
 }
 
 func (cfg *ApiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.FileserverHits.Add(1)
+		cfg.Metrics.FileserverHits.Inc()
 		next.ServeHTTP(w, r)
 	})
 }
 
 func (cfg *ApiConfig) metricHandle(res http.ResponseWriter, req *http.Request) {
-	req.Header.Set("Content-Type", "text/html")
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
 	res.WriteHeader(200)
-	write := []byte(fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", cfg.FileserverHits.Load()))
-	int, err := res.Write(write)
+	write := []byte(fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", cfg.Metrics.FileserverHits.Value()))
+	_, err := res.Write(write)
 	if err != nil {
-		fmt.Printf("%d: %v", int, err)
+		cfg.logger(req).Error("write response failed", "error", err)
 	}
 }
 
-func (cfg *ApiConfig) metricReset(res http.ResponseWriter, req *http.Request) {
-	godotenv.Load(".env")
-	dev := os.Getenv("PLATFORM")
-	if dev != "dev" {
-		healpers.RespondWithError(res, 403, "Forbidden")
+func (cfg *ApiConfig) metricReset(res http.ResponseWriter, req *http.Request) error {
+	if cfg.Config.Platform != "dev" {
+		return healpers.Forbidden(healpers.CodeForbidden, "Reset is only available in dev")
 	}
-	cfg.DB.Reset(req.Context())
-	cfg.FileserverHits.Add(-cfg.FileserverHits.Load())
-	req.Header.Set("Content-Type", "text/plain")
+	err := cfg.DB.Reset(req.Context())
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("reset users: %w", err))
+	}
+	cfg.Metrics.FileserverHits.Reset()
+	res.Header().Set("Content-Type", "text/plain")
 	res.WriteHeader(200)
-	write := []byte(fmt.Sprintf("Reset Successful hits: %v\n Users deleted", cfg.FileserverHits.Load()))
-	int, err := res.Write(write)
+	write := []byte(fmt.Sprintf("Reset Successful hits: %v\n Users deleted", cfg.Metrics.FileserverHits.Value()))
+	_, err = res.Write(write)
 	if err != nil {
-		fmt.Printf("%d: %v", int, err)
+		cfg.logger(req).Error("write response failed", "error", err)
 	}
+	return nil
 }
 
-func (cfg *ApiConfig) postHandle(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) postHandle(res http.ResponseWriter, req *http.Request) error {
 	type parameters struct {
-		Body    string    `json:"body"`
-		User_id uuid.UUID `json:"user_id"`
+		Body        string     `json:"body"`
+		User_id     uuid.UUID  `json:"user_id"`
+		In_reply_to *uuid.UUID `json:"in_reply_to"`
 	}
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		fmt.Printf("Decoding error: %v", err)
-		res.WriteHeader(400)
-		return
+		return healpers.MalformedBody(err)
 	}
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+	usr, _ := auth.UserIDFromContext(req.Context())
+	if cfg.Config.RequireVerifiedEmail {
+		verified, err := cfg.emailVerified(req.Context(), usr)
+		if err != nil {
+			return healpers.Internal(fmt.Errorf("get email verification: %w", err))
+		}
+		if !verified {
+			return healpers.Forbidden(healpers.CodeEmailNotVerified, "Verify your email before posting")
+		}
 	}
-	usr, err := auth.ValidateJWT(token, cfg.JWTSecret)
-	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+	var errs validate.Errors
+	errs.Add("body", validate.ChirpBody(params.Body))
+	if errs.Err() != nil {
+		return healpers.Validation(errs)
 	}
-	if len([]rune(params.Body)) > 140 {
-		healpers.RespondWithError(res, 400, "Chirpy is too long")
+	inReplyTo := uuid.NullUUID{}
+	if params.In_reply_to != nil {
+		_, err = cfg.getChirp(req.Context(), *params.In_reply_to)
+		if err != nil {
+			return err
+		}
+		inReplyTo = uuid.NullUUID{UUID: *params.In_reply_to, Valid: true}
+	}
+	verdict := cfg.Filter.Check(params.Body)
+	if verdict.Reject {
+		return healpers.Validation(validate.Errors{"body": "contains banned words"})
 	}
-	clean := healpers.StringCleaner(params.Body)
 	chirpsParam := database.CreateChirpParams{
-		Body:   clean,
-		UserID: usr,
+		Body:      verdict.Body,
+		UserID:    usr,
+		InReplyTo: inReplyTo,
 	}
 	chirp, err := cfg.DB.CreateChirp(req.Context(), chirpsParam)
+	if healpers.IsUniqueViolation(err) {
+		return healpers.Conflict(healpers.CodeDuplicateChirp, "A chirp with this body already exists")
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("create chirp: %w", err))
+	}
+	err = cfg.indexChirpEntities(req.Context(), chirp)
 	if err != nil {
-		fmt.Printf("Create Error: %v", err)
-		return
+		cfg.logger(req).Error("index chirp entities failed", "chirp_id", chirp.ID, "error", err)
 	}
-	jsonChirp := healpers.Chirp{
-		Id:         chirp.ID,
-		Created_at: chirp.CreatedAt,
-		Updated_at: chirp.UpdatedAt,
-		Body:       chirp.Body,
-		User_id:    chirp.UserID,
+	if verdict.Flag {
+		err = cfg.DB.FlagChirp(req.Context(), database.FlagChirpParams{
+			ChirpID: chirp.ID,
+			Matches: verdict.Matches,
+		})
+		if err != nil {
+			cfg.logger(req).Error("flag chirp failed", "chirp_id", chirp.ID, "error", err)
+		}
 	}
-	healpers.RespondWithJSON(res, 201, jsonChirp)
+	healpers.RespondWithJSON(res, req, 201, healpers.ChirpFromDB(chirp))
+	return nil
 }
 
-func (cfg *ApiConfig) createUserHandle(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) createUserHandle(res http.ResponseWriter, req *http.Request) error {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -160,21 +334,35 @@ func (cfg *ApiConfig) createUserHandle(res http.ResponseWriter, req *http.Reques
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		fmt.Printf("Decoding error: %v", err)
-		res.WriteHeader(400)
-		return
+		return healpers.MalformedBody(err)
+	}
+	var errs validate.Errors
+	email, err := validate.Email(params.Email)
+	errs.Add("email", err)
+	errs.Add("password", validate.Password(params.Password, email))
+	if errs.Err() != nil {
+		return healpers.Validation(errs)
 	}
 	passw, err := auth.HashPassword(params.Password)
 	if err != nil {
-		fmt.Printf("Password hash error: %v", err)
-		res.WriteHeader(400)
-		return
+		return healpers.Internal(fmt.Errorf("hash password: %w", err))
 	}
 	userParam := database.CreateUserParams{
-		Email:    params.Email,
+		Email:    email,
 		Password: passw,
 	}
 	usr, err := cfg.DB.CreateUser(req.Context(), userParam)
+	if healpers.IsUniqueViolation(err) {
+		return healpers.Conflict(healpers.CodeEmailTaken, "Email already in use")
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("create user: %w", err))
+	}
+	// The account exists either way; a lost email can be sent again.
+	err = cfg.sendVerificationEmail(req, usr.ID, usr.Email)
+	if err != nil {
+		cfg.logger(req).Error("send verification email failed", "error", err)
+	}
 	UserStruct := healpers.User{
 		Id:            usr.ID,
 		Created_at:    usr.CreatedAt,
@@ -182,69 +370,163 @@ func (cfg *ApiConfig) createUserHandle(res http.ResponseWriter, req *http.Reques
 		Email:         usr.Email,
 		Is_chirpy_red: usr.IsChirpyRed,
 	}
-	healpers.RespondWithJSON(res, 201, UserStruct)
+	healpers.RespondWithJSON(res, req, 201, UserStruct)
+	return nil
 }
 
-func (cfg *ApiConfig) getChirpsHandle(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) getChirpsHandle(res http.ResponseWriter, req *http.Request) error {
+	page, err := healpers.ParsePageParams(req.URL.Query())
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	authorID := uuid.NullUUID{}
 	Aid := req.URL.Query().Get("author_id")
-	chirps := []database.Chirp{}
-	var err error
 	if Aid != "" {
 		ID, err := uuid.Parse(Aid)
 		if err != nil {
-			healpers.RespondWithError(res, 400, fmt.Sprintf("Parse error: %v", err))
-		}
-		chirps, err = cfg.DB.GetChirpsAllAuthor(req.Context(), ID)
-		if err != nil {
-			healpers.RespondWithError(res, 400, fmt.Sprintf("Get chirps failed: %v", err))
+			return healpers.Invalid(healpers.CodeInvalidParameter, "author_id must be a UUID")
 		}
+		authorID = uuid.NullUUID{UUID: ID, Valid: true}
+	}
+	chirps := []database.Chirp{}
+	if page.Desc {
+		chirps, err = cfg.DB.GetChirpsPageDesc(req.Context(), database.GetChirpsPageDescParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: page.CursorCreatedAt(),
+			CursorID:        page.CursorID(),
+			PageLimit:       page.FetchLimit(),
+		})
 	} else {
-		chirps, err = cfg.DB.GetChirpsAll(req.Context())
-		if err != nil {
-			healpers.RespondWithError(res, 400, fmt.Sprintf("Get chirps failed: %v", err))
-		}
+		chirps, err = cfg.DB.GetChirpsPageAsc(req.Context(), database.GetChirpsPageAscParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: page.CursorCreatedAt(),
+			CursorID:        page.CursorID(),
+			PageLimit:       page.FetchLimit(),
+		})
 	}
-	jsonChirps := healpers.Chirps{}
-	for _, chirp := range chirps {
-		jsonChirp := healpers.Chirp{
-			Id:         chirp.ID,
-			Created_at: chirp.CreatedAt,
-			Updated_at: chirp.UpdatedAt,
-			Body:       chirp.Body,
-			User_id:    chirp.UserID,
-		}
-		jsonChirps = append(jsonChirps, jsonChirp)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get chirps: %w", err))
 	}
-	sortP := req.URL.Query().Get("sort")
-	if sortP == "desc" {
-		sort.Slice(jsonChirps, func(i int, j int) bool { return jsonChirps[i].Created_at.Compare(jsonChirps[j].Created_at) > 0 })
+	chirpPage := healpers.NewChirpPage(chirps, page.Limit)
+	err = cfg.decorateChirps(req.Context(), viewerID(req), chirpPage.Chirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	// This endpoint has always returned a bare array, so the cursor travels
+	// in a Link header instead of the page envelope the newer lists use.
+	if chirpPage.NextCursor != "" {
+		res.Header().Set("Link", healpers.NextLink(req.URL, chirpPage.NextCursor))
 	}
-	healpers.RespondWithJSON(res, 200, jsonChirps)
+	healpers.RespondWithJSON(res, req, 200, chirpPage.Chirps)
+	return nil
 }
 
-func (cfg *ApiConfig) getChirpHandle(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) getChirpHandle(res http.ResponseWriter, req *http.Request) error {
 	elements := strings.Split(req.RequestURI, "/")
 	idP, err := uuid.Parse(elements[3])
 	if err != nil {
-		healpers.RespondWithError(res, 404, "User not found")
-		return
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	chirp, err := cfg.getChirp(req.Context(), idP)
+	if err != nil {
+		return err
+	}
+	jsonChirps := healpers.Chirps{healpers.ChirpFromDB(chirp)}
+	err = cfg.decorateChirps(req.Context(), viewerID(req), jsonChirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	healpers.RespondWithJSON(res, req, 200, jsonChirps[0])
+	return nil
+}
+
+// getChirp loads a chirp, telling a missing one apart from a failed query.
+func (cfg *ApiConfig) getChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.DB.GetChirp(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return chirp, healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	if err != nil {
+		return chirp, healpers.Internal(fmt.Errorf("get chirp: %w", err))
+	}
+	return chirp, nil
+}
+
+// getChirpThread returns the chain of chirps above the requested one, root
+// first, and every reply below it as a tree.
+func (cfg *ApiConfig) getChirpThread(res http.ResponseWriter, req *http.Request) error {
+	idP, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	chirp, err := cfg.getChirp(req.Context(), idP)
+	if err != nil {
+		return err
+	}
+	ancestors, err := cfg.DB.GetChirpAncestors(req.Context(), chirp.ID)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get ancestors: %w", err))
+	}
+	descendants, err := cfg.DB.GetChirpDescendants(req.Context(), uuid.NullUUID{UUID: chirp.ID, Valid: true})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get descendants: %w", err))
+	}
+	all := healpers.Chirps{healpers.ChirpFromDB(chirp)}
+	for _, row := range ancestors {
+		all = append(all, healpers.ChirpFromDB(database.Chirp(row)))
+	}
+	for _, row := range descendants {
+		all = append(all, healpers.ChirpFromDB(database.Chirp(row)))
+	}
+	err = cfg.decorateChirps(req.Context(), viewerID(req), all)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	thread := healpers.ChirpThread{
+		Ancestors: all[1 : 1+len(ancestors)],
+		Chirp:     healpers.BuildThread(all[0], all[1+len(ancestors):]),
+	}
+	healpers.RespondWithJSON(res, req, 200, thread)
+	return nil
+}
+
+// decorateChirps fills in the counters that are not stored on the chirp row.
+func (cfg *ApiConfig) decorateChirps(ctx context.Context, viewer uuid.NullUUID, chirps healpers.Chirps) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.Id)
+	}
+	counts, err := cfg.DB.GetReplyCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+	replyCounts := map[uuid.UUID]int64{}
+	for _, count := range counts {
+		replyCounts[count.InReplyTo.UUID] = count.ReplyCount
 	}
-	chirp, err := cfg.DB.GetChirp(req.Context(), idP)
+	likes, err := cfg.DB.GetLikeCounts(ctx, database.GetLikeCountsParams{
+		ViewerID: viewer,
+		ChirpIds: ids,
+	})
 	if err != nil {
-		healpers.RespondWithError(res, 404, "Get chirp error")
-		return
+		return err
+	}
+	likeCounts := map[uuid.UUID]database.GetLikeCountsRow{}
+	for _, like := range likes {
+		likeCounts[like.ChirpID] = like
 	}
-	jsonChirp := healpers.Chirp{
-		Id:         chirp.ID,
-		Created_at: chirp.CreatedAt,
-		Updated_at: chirp.UpdatedAt,
-		Body:       chirp.Body,
-		User_id:    chirp.UserID,
+	for i := range chirps {
+		chirps[i].Reply_count = replyCounts[chirps[i].Id]
+		chirps[i].Like_count = likeCounts[chirps[i].Id].LikeCount
+		chirps[i].Liked_by_me = likeCounts[chirps[i].Id].LikedByMe
 	}
-	healpers.RespondWithJSON(res, 200, jsonChirp)
+	return nil
 }
 
-func (cfg *ApiConfig) postLoginHandle(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) postLoginHandle(res http.ResponseWriter, req *http.Request) error {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -253,108 +535,214 @@ func (cfg *ApiConfig) postLoginHandle(res http.ResponseWriter, req *http.Request
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		fmt.Printf("Decoding error: %v", err)
-		healpers.RespondWithError(res, 400, "Decoding Error")
-		return
+		return healpers.MalformedBody(err)
 	}
-	usr, err := cfg.DB.GetUserEmail(req.Context(), params.Email)
+	email := validate.NormalizeEmail(params.Email)
+	err = cfg.loginThrottled(res, req, email)
 	if err != nil {
-		fmt.Printf("User error: %v", err)
-		healpers.RespondWithError(res, 400, "User Does Not Exist")
-		return
+		return err
 	}
-	err = auth.CheckPasswordHash(usr.Password, params.Password)
+	err = cfg.loginLocked(res, req, email)
 	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+		return err
+	}
+	usr, err := cfg.DB.GetUserEmail(req.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.Metrics.Logins.WithLabelValues("unknown_user").Inc()
+		cfg.recordLoginFailure(req, email)
+		return healpers.Unauthorized(healpers.CodeInvalidCredentials, "Incorrect email or password")
 	}
-	expiersIn := 3600
-	sec, err := time.ParseDuration(strconv.Itoa(expiersIn) + "s")
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Parse Time Error")
-		return
+		return healpers.Internal(fmt.Errorf("get user: %w", err))
 	}
-	token, err := auth.MakeJWT(usr.ID, cfg.JWTSecret, sec)
+	err = auth.CheckPasswordHash(usr.Password, params.Password)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Make JWT error")
-		return
+		cfg.logger(req).Debug("password check failed", "error", err)
+		cfg.Metrics.Logins.WithLabelValues("bad_password").Inc()
+		cfg.recordLoginFailure(req, email)
+		return healpers.Unauthorized(healpers.CodeInvalidCredentials, "Incorrect email or password")
 	}
-	refToke, err := auth.MakeRefreshToken()
+	err = cfg.DB.ClearLoginFailures(req.Context(), email)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Make RefreshT error")
-		return
+		cfg.logger(req).Error("clear login failures failed", "error", err)
 	}
-	refCretTok, err := healpers.CreateRefreshToken(usr.ID, refToke)
+	refToke, err := auth.MakeRefreshToken()
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Make RefreshTDB error")
-		return
+		return healpers.Internal(fmt.Errorf("make refresh token: %w", err))
 	}
+	refCretTok := healpers.CreateRefreshToken(usr.ID, refToke, cfg.Config.RefreshLifetime)
+	refCretTok.UserAgent = req.UserAgent()
+	refCretTok.Ip = clientIP(req)
 	_, err = cfg.DB.CreateRefreshToken(req.Context(), refCretTok)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Make RefreshTDB error")
-		return
+		return healpers.Internal(fmt.Errorf("store refresh token: %w", err))
 	}
-	userJson := healpers.User{
-		Id:            usr.ID,
-		Created_at:    usr.CreatedAt,
-		Updated_at:    usr.UpdatedAt,
-		Email:         usr.Email,
-		Token:         token,
-		Refresh_token: refToke,
-		Is_chirpy_red: usr.IsChirpyRed,
+	token, err := cfg.keys(req).MakeSessionJWT(usr.ID, refCretTok.FamilyID, cfg.Config.JWTLifetime)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("make JWT: %w", err))
 	}
-	healpers.RespondWithJSON(res, 200, userJson)
+	userJson := healpers.User{
+		Id:             usr.ID,
+		Created_at:     usr.CreatedAt,
+		Updated_at:     usr.UpdatedAt,
+		Email:          usr.Email,
+		Token:          token,
+		Refresh_token:  refToke,
+		Is_chirpy_red:  usr.IsChirpyRed,
+		Email_verified: usr.EmailVerifiedAt.Valid,
+	}
+	cfg.Metrics.Logins.WithLabelValues("success").Inc()
+	healpers.RespondWithJSON(res, req, 200, userJson)
+	return nil
 }
 
-func (cfg *ApiConfig) postRefres(res http.ResponseWriter, req *http.Request) {
+// postRefres exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token works once: presenting one that was
+// already rotated out means it leaked, so its whole family is revoked.
+func (cfg *ApiConfig) postRefres(res http.ResponseWriter, req *http.Request) error {
 	type params struct {
-		Token string `json:"token"`
+		Token         string `json:"token"`
+		Refresh_token string `json:"refresh_token"`
 	}
 	toke, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+		return unauthorized(res, "Bearer", err)
+	}
+	refToken, err := cfg.DB.GetUserFromRefreshToken(req.Context(), auth.HashToken(toke))
+	if errors.Is(err, sql.ErrNoRows) {
+		return unauthorized(res, "Bearer", errors.New("unknown refresh token"))
 	}
-	usrID, err := cfg.DB.GetUserFromRefreshToken(req.Context(), toke)
 	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+		return healpers.Internal(fmt.Errorf("get refresh token: %w", err))
 	}
-	if usrID.RevokedAt.Valid {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+	revokeFamily := func() { cfg.revokeTokenFamily(req, refToken) }
+	err = rejectRefresh(res, checkRefreshToken(refToken, time.Now()), revokeFamily)
+	if err != nil {
+		return err
 	}
-	JWTToke, err := auth.MakeJWT(usrID.UserID, cfg.JWTSecret, time.Hour)
+	newToke, err := auth.MakeRefreshToken()
 	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+		return healpers.Internal(fmt.Errorf("make refresh token: %w", err))
+	}
+	_, err = cfg.DB.RotateRefreshToken(req.Context(), database.RotateRefreshTokenParams{
+		OldTokenHash: refToken.TokenHash,
+		NewTokenHash: auth.HashToken(newToke),
+		ExpiresAt:    time.Now().Add(cfg.Config.RefreshLifetime),
+		UserAgent:    req.UserAgent(),
+		Ip:           clientIP(req),
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return healpers.Internal(fmt.Errorf("rotate refresh token: %w", err))
+	}
+	err = rejectRefresh(res, checkRotation(err), revokeFamily)
+	if err != nil {
+		return err
+	}
+	JWTToke, err := cfg.keys(req).MakeSessionJWT(refToken.UserID, refToken.FamilyID, cfg.Config.JWTLifetime)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("make JWT: %w", err))
 	}
 	parap := params{
-		Token: JWTToke,
+		Token:         JWTToke,
+		Refresh_token: newToke,
+	}
+	healpers.RespondWithJSON(res, req, 200, parap)
+	return nil
+}
+
+// refreshCheck is the verdict on a refresh token presented to postRefres.
+type refreshCheck int
+
+const (
+	refreshValid refreshCheck = iota
+	// refreshReused means the token was already rotated out, so someone
+	// holds a copy. The whole family is revoked.
+	refreshReused
+	refreshRevoked
+	refreshExpired
+)
+
+// checkRefreshToken judges a refresh token as read from the database. Reuse
+// is checked first: revoking a family also revokes its rotated tokens, and
+// those must still count as reuse.
+func checkRefreshToken(refToken database.RefreshToken, now time.Time) refreshCheck {
+	switch {
+	case refToken.RotatedAt.Valid:
+		return refreshReused
+	case refToken.RevokedAt.Valid:
+		return refreshRevoked
+	case now.After(refToken.ExpiresAt):
+		return refreshExpired
+	}
+	return refreshValid
+}
+
+// checkRotation judges the outcome of RotateRefreshToken. No row means
+// another request rotated or revoked the token since it was read, which is
+// treated as reuse.
+func checkRotation(err error) refreshCheck {
+	if errors.Is(err, sql.ErrNoRows) {
+		return refreshReused
+	}
+	return refreshValid
+}
+
+// rejectRefresh turns a verdict into the 401 to send, calling revokeFamily
+// first on reuse. It returns nil when the token may be rotated.
+func rejectRefresh(res http.ResponseWriter, check refreshCheck, revokeFamily func()) error {
+	switch check {
+	case refreshReused:
+		revokeFamily()
+		return refreshTokenReused(res)
+	case refreshRevoked:
+		return unauthorized(res, "Bearer", errors.New("refresh token revoked"))
+	case refreshExpired:
+		return unauthorized(res, "Bearer", fmt.Errorf("%w: refresh token expired", auth.ErrTokenExpired))
+	}
+	return nil
+}
+
+// refreshTokenReused is the 401 for a refresh token presented after it was
+// rotated out.
+func refreshTokenReused(res http.ResponseWriter) *healpers.AppError {
+	appErr := unauthorized(res, "Bearer", errors.New("refresh token reused"))
+	appErr.Code, appErr.Detail = healpers.CodeTokenReused, "Refresh token already used"
+	return appErr
+}
+
+func (cfg *ApiConfig) revokeTokenFamily(req *http.Request, refToken database.RefreshToken) {
+	cfg.logger(req).Warn("refresh token reuse detected, revoking family",
+		"user_id", refToken.UserID.String(),
+		"family_id", refToken.FamilyID.String(),
+	)
+	err := cfg.DB.RevokeRefreshTokenFamily(req.Context(), refToken.FamilyID)
+	if err != nil {
+		cfg.logger(req).Error("revoke refresh token family failed", "error", err)
 	}
-	healpers.RespondWithJSON(res, 200, parap)
 }
 
-func (cfg *ApiConfig) postRevoke(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) postRevoke(res http.ResponseWriter, req *http.Request) error {
 	toke, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Header missing Token")
-		return
+		return unauthorized(res, "Bearer", err)
+	}
+	tokeHash := auth.HashToken(toke)
+	_, err = cfg.DB.GetUserFromRefreshToken(req.Context(), tokeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return unauthorized(res, "Bearer", errors.New("unknown refresh token"))
 	}
-	usrID, err := cfg.DB.GetUserFromRefreshToken(req.Context(), toke)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Token not Valid")
-		return
+		return healpers.Internal(fmt.Errorf("get refresh token: %w", err))
 	}
-	err = cfg.DB.RevokeRefreshToken(req.Context(), usrID.UserID)
+	err = cfg.DB.RevokeRefreshToken(req.Context(), tokeHash)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Revoke Token Error")
-		return
+		return healpers.Internal(fmt.Errorf("revoke refresh token: %w", err))
 	}
 	res.WriteHeader(204)
+	return nil
 }
 
-func (cfg *ApiConfig) putUserUpdate(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) putUserUpdate(res http.ResponseWriter, req *http.Request) error {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -363,105 +751,129 @@ func (cfg *ApiConfig) putUserUpdate(res http.ResponseWriter, req *http.Request)
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Decoding Error")
-		return
+		return healpers.MalformedBody(err)
 	}
-	toke, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+	var errs validate.Errors
+	email, err := validate.Email(params.Email)
+	errs.Add("email", err)
+	errs.Add("password", validate.Password(params.Password, email))
+	if errs.Err() != nil {
+		return healpers.Validation(errs)
+	}
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	current, err := cfg.DB.GetUserVerification(req.Context(), usrID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return healpers.NotFound(healpers.CodeUserNotFound, "User not found")
 	}
-	usrID, err := auth.ValidateJWT(toke, cfg.JWTSecret)
 	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+		return healpers.Internal(fmt.Errorf("get user: %w", err))
+	}
+	if email != current.Email {
+		owner, err := cfg.DB.GetUserEmail(req.Context(), email)
+		if err == nil && owner.ID != usrID {
+			return healpers.Conflict(healpers.CodeEmailTaken, "Email already in use")
+		}
 	}
 	HashPass, err := auth.HashPassword(params.Password)
 	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+		return healpers.Internal(fmt.Errorf("hash password: %w", err))
 	}
-	UpParam := database.UpdateUserEmailPasswordParams{
-		Email:    params.Email,
-		Password: HashPass,
+	err = cfg.DB.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
 		ID:       usrID,
+		Password: HashPass,
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("update password: %w", err))
 	}
-	err = cfg.DB.UpdateUserEmailPassword(req.Context(), UpParam)
+	// A new email only replaces the current one once it is confirmed.
+	// Asking for the current email again cancels a pending change.
+	pending := sql.NullString{}
+	if email != current.Email {
+		pending = sql.NullString{String: email, Valid: true}
+	}
+	err = cfg.DB.SetUserPendingEmail(req.Context(), database.SetUserPendingEmailParams{
+		ID:           usrID,
+		PendingEmail: pending,
+	})
 	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
+		return healpers.Internal(fmt.Errorf("set pending email: %w", err))
+	}
+	if pending.Valid {
+		err = cfg.sendVerificationEmail(req, usrID, pending.String)
+		if err != nil {
+			cfg.logger(req).Error("send verification email failed", "error", err)
+		}
 	}
 	type retStruct struct {
-		Email string `json:"email"`
+		Email         string `json:"email"`
+		Pending_email string `json:"pending_email,omitempty"`
 	}
-	Ret := retStruct{Email: params.Email}
-	healpers.RespondWithJSON(res, 200, Ret)
+	Ret := retStruct{Email: current.Email, Pending_email: pending.String}
+	healpers.RespondWithJSON(res, req, 200, Ret)
+	return nil
 }
 
-func (cfg *ApiConfig) deleteChirp(res http.ResponseWriter, req *http.Request) {
-	toke, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
-	}
-	usrID, err := auth.ValidateJWT(toke, cfg.JWTSecret)
-	if err != nil {
-		healpers.RespondWithError(res, 401, "Unauthorized")
-		return
-	}
+func (cfg *ApiConfig) deleteChirp(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
 	elements := strings.Split(req.RequestURI, "/")
 	idP, err := uuid.Parse(elements[3])
 	if err != nil {
-		healpers.RespondWithError(res, 404, "User not found")
-		return
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
 	}
-	chirp, err := cfg.DB.GetChirp(req.Context(), idP)
+	chirp, err := cfg.getChirp(req.Context(), idP)
 	if err != nil {
-		healpers.RespondWithError(res, 404, "Get chirp error")
-		return
+		return err
 	}
 	if chirp.UserID != usrID {
-		healpers.RespondWithError(res, 403, "User not creator")
-		return
+		return healpers.Forbidden(healpers.CodeNotAuthor, "Only the author can delete a chirp")
 	}
-	err = cfg.DB.DeleteChirp(req.Context(), chirp.ID)
+	err = cfg.DB.SoftDeleteChirp(req.Context(), chirp.ID)
 	if err != nil {
-		healpers.RespondWithError(res, 404, "Delete chirp error")
-		return
+		return healpers.Internal(fmt.Errorf("delete chirp: %w", err))
 	}
 	res.WriteHeader(204)
+	return nil
 }
 
-func (cfg *ApiConfig) postPolkaWebhook(res http.ResponseWriter, req *http.Request) {
+func (cfg *ApiConfig) postPolkaWebhook(res http.ResponseWriter, req *http.Request) error {
 	api, err := auth.GetAPIKey(req.Header)
 	if err != nil {
-		healpers.RespondWithError(res, 401, "API Error")
-		return
+		cfg.Metrics.Webhooks.WithLabelValues("unauthorized").Inc()
+		return unauthorized(res, "ApiKey", err)
 	}
-	if api != cfg.PolkaKey {
-		healpers.RespondWithError(res, 401, "Unautherized")
-		return
+	if api != cfg.Config.PolkaKey {
+		cfg.Metrics.Webhooks.WithLabelValues("unauthorized").Inc()
+		return unauthorized(res, "ApiKey", errors.New("wrong API key"))
 	}
 	decoder := json.NewDecoder(req.Body)
 	params := healpers.PolkaWebHook{}
 	err = decoder.Decode(&params)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Decoding Error")
-		return
+		cfg.Metrics.Webhooks.WithLabelValues("bad_request").Inc()
+		return healpers.MalformedBody(err)
 	}
+	// Polka retries anything but a 2xx, so other events are acknowledged
+	// and dropped.
 	if params.Event != "user.upgraded" {
-		healpers.RespondWithError(res, 204, "Decoding Error")
-		return
+		cfg.Metrics.Webhooks.WithLabelValues("ignored").Inc()
+		res.WriteHeader(204)
+		return nil
 	}
 	id, err := uuid.Parse(params.Data.UserID)
 	if err != nil {
-		healpers.RespondWithError(res, 400, "Parse Error")
-		return
+		cfg.Metrics.Webhooks.WithLabelValues("bad_request").Inc()
+		return healpers.Invalid(healpers.CodeInvalidParameter, "data.user_id must be a UUID")
 	}
-	err = cfg.DB.SetUserToRed(req.Context(), id)
+	upgraded, err := cfg.DB.SetUserToRed(req.Context(), id)
 	if err != nil {
-		healpers.RespondWithError(res, 404, "User Not Found")
-		return
+		return healpers.Internal(fmt.Errorf("set user to red: %w", err))
+	}
+	if upgraded == 0 {
+		cfg.Metrics.Webhooks.WithLabelValues("user_not_found").Inc()
+		return healpers.NotFound(healpers.CodeUserNotFound, "User not found")
 	}
+	cfg.redUsers.set(id, true)
+	cfg.Metrics.Webhooks.WithLabelValues("upgraded").Inc()
 	res.WriteHeader(204)
+	return nil
 }
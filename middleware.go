@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	accessLogKey
+)
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// logger returns the server logger tagged with the request's ID.
+func (cfg *ApiConfig) logger(req *http.Request) *slog.Logger {
+	return cfg.Logger.With("request_id", RequestIDFromContext(req.Context()))
+}
+
+// keys returns the key set logging through the request's logger.
+func (cfg *ApiConfig) keys(req *http.Request) *auth.KeySet {
+	return cfg.Keys.WithLogger(cfg.logger(req))
+}
+
+// middlewareRequestID reuses the caller's X-Request-ID when it looks sane,
+// otherwise generates one, and echoes it on the response.
+func (cfg *ApiConfig) middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = healpers.ContextWithLogger(ctx, cfg.Logger.With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// middlewareAccessLog writes one line per request. Everything between it and
+// the mux must pass the same request along so that the mux fills in
+// r.Pattern where this can see it.
+func (cfg *ApiConfig) middlewareAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		entry := &accessLogEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogKey, entry))
+		next.ServeHTTP(rec, r)
+		attrs := []any{
+			"method", r.Method,
+			"route", r.Pattern,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", rec.bytes,
+		}
+		if entry.userID.Valid {
+			attrs = append(attrs, "user_id", entry.userID.UUID.String())
+		}
+		cfg.logger(r).Info("request", attrs...)
+	})
+}
+
+// accessLogEntry lets handlers further down the chain, such as the auth
+// middleware, report details the access log can't see from the outside.
+type accessLogEntry struct {
+	userID uuid.NullUUID
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// middlewareMetrics records request counts, latency and in-flight requests
+// per route pattern. Like the access log it relies on the mux filling in
+// r.Pattern on the request it was given.
+func (cfg *ApiConfig) middlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		cfg.Metrics.InFlight.Inc()
+		defer cfg.Metrics.InFlight.Dec()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		// The pattern already carries the method. Unmatched requests share
+		// one label so scanners can't blow up the number of series.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		cfg.Metrics.HTTPRequests.WithLabelValues(route, strconv.Itoa(rec.status)).Inc()
+		cfg.Metrics.HTTPDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RequireAuth only lets requests with a valid access token through. The
+// caller's ID and token claims are available to next via the auth package's
+// context accessors.
+func (cfg *ApiConfig) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		req, err := cfg.authenticate(req)
+		if err != nil {
+			cfg.rejectAuth(res, req, err)
+			return
+		}
+		next(res, req)
+	}
+}
+
+// OptionalAuth serves anonymous requests as well as authenticated ones, but
+// a token that is present and invalid is still rejected so clients notice.
+func (cfg *ApiConfig) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		authed, err := cfg.authenticate(req)
+		if errors.Is(err, auth.ErrMissingToken) {
+			next(res, req)
+			return
+		}
+		if err != nil {
+			cfg.rejectAuth(res, req, err)
+			return
+		}
+		next(res, authed)
+	}
+}
+
+func (cfg *ApiConfig) authenticate(req *http.Request) (*http.Request, error) {
+	toke, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return req, err
+	}
+	claims, err := cfg.keys(req).ParseJWT(toke)
+	if err != nil {
+		return req, err
+	}
+	usrID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return req, err
+	}
+	// Tokens from before sessions carry no sid and can't be revoked early.
+	if claims.SessionID != "" {
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			return req, fmt.Errorf("%w: bad sid: %w", auth.ErrTokenClaims, err)
+		}
+		active, err := cfg.DB.IsSessionActive(req.Context(), sessionID)
+		if err != nil {
+			return req, healpers.Internal(fmt.Errorf("check session: %w", err))
+		}
+		if !active {
+			return req, auth.ErrSessionRevoked
+		}
+	}
+	if entry, ok := req.Context().Value(accessLogKey).(*accessLogEntry); ok {
+		entry.userID = uuid.NullUUID{UUID: usrID, Valid: true}
+	}
+	return req.WithContext(auth.ContextWithUser(req.Context(), usrID, claims)), nil
+}
+
+// rejectAuth answers a failed authenticate: 401 for bad credentials, or the
+// error itself when checking them failed.
+func (cfg *ApiConfig) rejectAuth(res http.ResponseWriter, req *http.Request, err error) {
+	var appErr *healpers.AppError
+	if errors.As(err, &appErr) {
+		cfg.logger(req).Error("request failed", "error", err)
+		healpers.RespondWithProblem(res, req, appErr)
+		return
+	}
+	healpers.RespondWithProblem(res, req, unauthorized(res, "Bearer", err))
+}
+
+// unauthorized is the single 401 for every auth failure. It sets the
+// challenge, which tells the client which scheme to use and, when it sent
+// credentials, why they were rejected.
+func unauthorized(res http.ResponseWriter, scheme string, err error) *healpers.AppError {
+	challenge := scheme + ` realm="chirpy"`
+	appErr := healpers.Unauthorized(healpers.CodeUnauthorized, "Unauthorized")
+	if err != nil && !errors.Is(err, auth.ErrMissingToken) {
+		desc := "invalid token"
+		appErr = healpers.Unauthorized(healpers.CodeTokenInvalid, "Invalid token")
+		switch {
+		case errors.Is(err, auth.ErrTokenExpired):
+			desc = "token expired"
+			appErr = healpers.Unauthorized(healpers.CodeTokenExpired, "Token expired")
+		case errors.Is(err, auth.ErrTokenMalformed):
+			desc, appErr.Detail = "malformed token", "Malformed token"
+		case errors.Is(err, auth.ErrTokenSignature):
+			desc, appErr.Detail = "invalid signature", "Invalid token signature"
+		case errors.Is(err, auth.ErrTokenClaims):
+			desc, appErr.Detail = "invalid claims", "Invalid token claims"
+		case errors.Is(err, auth.ErrSessionRevoked):
+			desc, appErr.Detail = "session revoked", "This session has been logged out"
+		}
+		challenge += `, error="invalid_token", error_description="` + desc + `"`
+	}
+	appErr.Err = err
+	res.Header().Set("WWW-Authenticate", challenge)
+	return appErr
+}
+
+// tooManyRequests tells the client to come back after wait, rounded up to
+// whole seconds as Retry-After requires.
+func tooManyRequests(res http.ResponseWriter, wait time.Duration, code, detail string) *healpers.AppError {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	res.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	return healpers.RateLimited(code, detail)
+}
+
+// apiHandler is a handler that returns its errors instead of writing them.
+type apiHandler func(res http.ResponseWriter, req *http.Request) error
+
+// handle turns an apiHandler into an http.HandlerFunc. Errors become
+// problem+json responses, and internal ones are logged with their cause.
+func (cfg *ApiConfig) handle(h apiHandler) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		err := h(res, req)
+		if err == nil {
+			return
+		}
+		appErr := healpers.AsAppError(err)
+		if appErr.Kind == healpers.KindInternal {
+			cfg.logger(req).Error("request failed", "error", err)
+		}
+		healpers.RespondWithProblem(res, req, appErr)
+	}
+}
+
+// clientIP is the address of the connecting peer. Forwarding headers are
+// ignored since they can be set by anyone.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// viewerID returns the caller's user ID on endpoints wrapped in
+// OptionalAuth. Anonymous callers get an invalid NullUUID.
+func viewerID(req *http.Request) uuid.NullUUID {
+	usrID, ok := auth.UserIDFromContext(req.Context())
+	return uuid.NullUUID{UUID: usrID, Valid: ok}
+}
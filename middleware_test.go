@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/CookieBorn/chirpy/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareRequestIDAndAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &ApiConfig{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if RequestIDFromContext(r.Context()) != "abc-123" {
+			t.Errorf("Request ID not in context: %q", RequestIDFromContext(r.Context()))
+		}
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+	handler := cfg.middlewareRequestID(cfg.middlewareAccessLog(mux))
+
+	req := httptest.NewRequest("GET", "/api/things/42", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("Request ID not echoed, got %q", got)
+	}
+	entry := map[string]any{}
+	err := json.Unmarshal(logs.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("Access log is not JSON: %v: %s", err, logs.String())
+	}
+	want := map[string]any{
+		"request_id": "abc-123",
+		"method":     "GET",
+		"route":      "GET /api/things/{id}",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(len("short and stout")),
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("Access log %s = %v, want %v", k, entry[k], v)
+		}
+	}
+}
+
+func TestMiddlewareRequestIDGenerated(t *testing.T) {
+	cfg := &ApiConfig{Logger: slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))}
+	handler := cfg.middlewareRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\nwith newline")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	got := rec.Header().Get("X-Request-ID")
+	if got == "" || got == req.Header.Get("X-Request-ID") {
+		t.Errorf("Expected a freshly generated request ID, got %q", got)
+	}
+}
+
+func TestMiddlewareMetrics(t *testing.T) {
+	cfg := &ApiConfig{Metrics: metrics.New()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if got := testutil.ToFloat64(cfg.Metrics.InFlight); got != 1 {
+			t.Errorf("Expected 1 request in flight, got %v", got)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := cfg.middlewareMetrics(mux)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/things/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/things/2", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/nope", nil))
+
+	if got := testutil.ToFloat64(cfg.Metrics.HTTPRequests.WithLabelValues("GET /api/things/{id}", "404")); got != 2 {
+		t.Errorf("Expected 2 requests for the route, got %v", got)
+	}
+	if got := testutil.ToFloat64(cfg.Metrics.HTTPRequests.WithLabelValues("unmatched", "404")); got != 1 {
+		t.Errorf("Expected 1 unmatched request, got %v", got)
+	}
+	if got := testutil.ToFloat64(cfg.Metrics.InFlight); got != 0 {
+		t.Errorf("Expected no requests in flight, got %v", got)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &ApiConfig{
+		Keys:   auth.NewHMACKeySet("test_secret"),
+		Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+	}
+	userID := uuid.New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /private", cfg.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := auth.UserIDFromContext(r.Context())
+		if !ok || got != userID {
+			t.Errorf("User ID in context = %v, %v; want %v", got, ok, userID)
+		}
+		claims, ok := auth.ClaimsFromContext(r.Context())
+		if !ok || claims.Issuer != "chirpy" {
+			t.Errorf("Unexpected claims in context: %+v", claims)
+		}
+	}))
+	handler := cfg.middlewareAccessLog(mux)
+
+	token, err := auth.MakeJWT(userID, "test_secret", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/private", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with a valid token, got %d", rec.Code)
+	}
+	if !strings.Contains(logs.String(), `"user_id":"`+userID.String()+`"`) {
+		t.Errorf("Access log is missing the user ID: %s", logs.String())
+	}
+
+	expired, err := auth.MakeJWT(userID, "test_secret", -time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	cases := map[string]string{
+		"":                      `Bearer realm="chirpy"`,
+		"Bearer not-a-jwt":      `Bearer realm="chirpy", error="invalid_token", error_description="malformed token"`,
+		"Bearer " + token + "x": `Bearer realm="chirpy", error="invalid_token", error_description="invalid signature"`,
+		"Bearer " + expired:     `Bearer realm="chirpy", error="invalid_token", error_description="token expired"`,
+	}
+	for header, challenge := range cases {
+		req := httptest.NewRequest("GET", "/private", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", header, rec.Code)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != challenge {
+			t.Errorf("Authorization %q: WWW-Authenticate = %q, want %q", header, got, challenge)
+		}
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	cfg := &ApiConfig{Keys: auth.NewHMACKeySet("test_secret"), Logger: slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))}
+	var viewer uuid.NullUUID
+	handler := cfg.OptionalAuth(func(w http.ResponseWriter, r *http.Request) {
+		viewer = viewerID(r)
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || viewer.Valid {
+		t.Errorf("Expected anonymous access, got %d and viewer %v", rec.Code, viewer)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer garbage")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an invalid token, got %d", rec.Code)
+	}
+}
+
+func TestHandleWritesProblems(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &ApiConfig{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found"), 404, healpers.CodeChirpNotFound},
+		{errors.New("pq: connection refused"), 500, healpers.CodeInternal},
+	}
+	for _, c := range cases {
+		logs.Reset()
+		rec := httptest.NewRecorder()
+		cfg.handle(func(http.ResponseWriter, *http.Request) error { return c.err })(rec, httptest.NewRequest("GET", "/api/chirps/x", nil))
+		if rec.Code != c.status || rec.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%v: got %d %q", c.err, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		problem := healpers.Problem{}
+		json.Unmarshal(rec.Body.Bytes(), &problem)
+		if problem.Code != c.code || problem.Status != c.status {
+			t.Errorf("%v: unexpected problem %+v", c.err, problem)
+		}
+		if strings.Contains(rec.Body.String(), "pq:") {
+			t.Errorf("Internal error leaked to the client: %s", rec.Body)
+		}
+		if logged := strings.Contains(logs.String(), "request failed"); logged != (c.status == 500) {
+			t.Errorf("%v: logged = %v", c.err, logged)
+		}
+	}
+}
+
+func TestAuthLogsCarryRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &ApiConfig{
+		Keys:   auth.NewHMACKeySet("test_secret"),
+		Logger: slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	handler := cfg.middlewareRequestID(cfg.RequireAuth(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/api/timeline", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := map[string]any{}
+	err := json.Unmarshal(logs.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("Expected one JSON log line: %v: %s", err, logs.String())
+	}
+	if entry["msg"] != "parse JWT failed" || entry["request_id"] != "abc-123" {
+		t.Errorf("Unexpected auth log %v", entry)
+	}
+}
+
+func TestPlainHandlersSetContentType(t *testing.T) {
+	cfg := &ApiConfig{Metrics: metrics.New(), Logger: slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))}
+	cases := map[string]http.HandlerFunc{
+		"text/plain; charset=utf-8": ReadinessHandeler,
+		"text/html; charset=utf-8":  cfg.metricHandle,
+	}
+	for want, h := range cases {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/", nil))
+		if got := rec.Header().Get("Content-Type"); got != want {
+			t.Errorf("Got Content-Type %q, want %q", got, want)
+		}
+	}
+}
+
+func TestUnauthorizedSessionRevoked(t *testing.T) {
+	rec := httptest.NewRecorder()
+	appErr := unauthorized(rec, "Bearer", auth.ErrSessionRevoked)
+	if appErr.Code != healpers.CodeTokenInvalid || appErr.Status() != http.StatusUnauthorized {
+		t.Errorf("Unexpected error %+v", appErr)
+	}
+	want := `Bearer realm="chirpy", error="invalid_token", error_description="session revoked"`
+	if got := rec.Header().Get("WWW-Authenticate"); got != want {
+		t.Errorf("WWW-Authenticate = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	"github.com/CookieBorn/chirpy/internal/filter"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/CookieBorn/chirpy/internal/validate"
+)
+
+// loadFilterWords rebuilds the content filter's word list from the
+// banned_words table plus the optional FILTER_WORDS_FILE. If the table can't
+// be read the built-in defaults are used so chirps are never unfiltered.
+func (cfg *ApiConfig) loadFilterWords(ctx context.Context) error {
+	words, err := cfg.DB.ListBannedWords(ctx)
+	if err != nil {
+		cfg.Filter.SetWords(filter.DefaultWords)
+		return err
+	}
+	if path := cfg.Config.FilterWordsFile; path != "" {
+		fileWords, err := filter.LoadWordFile(path)
+		if err != nil {
+			return err
+		}
+		words = append(words, fileWords...)
+	}
+	cfg.Filter.SetWords(words)
+	return nil
+}
+
+// requireAdmin returns an error unless the request carries the admin key.
+func (cfg *ApiConfig) requireAdmin(req *http.Request) error {
+	if cfg.Config.AdminKey == "" {
+		return healpers.Forbidden(healpers.CodeAdminDisabled, "Admin API disabled")
+	}
+	key, err := auth.GetAPIKey(req.Header)
+	if err != nil || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.Config.AdminKey)) != 1 {
+		return healpers.Unauthorized(healpers.CodeUnauthorized, "Unauthorized")
+	}
+	return nil
+}
+
+func (cfg *ApiConfig) getFilterWords(res http.ResponseWriter, req *http.Request) error {
+	err := cfg.requireAdmin(req)
+	if err != nil {
+		return err
+	}
+	words, err := cfg.DB.ListBannedWords(req.Context())
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("list banned words: %w", err))
+	}
+	type retStruct struct {
+		Words []string `json:"words"`
+	}
+	healpers.RespondWithJSON(res, req, 200, retStruct{Words: append([]string{}, words...)})
+	return nil
+}
+
+func (cfg *ApiConfig) postFilterWord(res http.ResponseWriter, req *http.Request) error {
+	err := cfg.requireAdmin(req)
+	if err != nil {
+		return err
+	}
+	type parameters struct {
+		Word string `json:"word"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		return healpers.MalformedBody(err)
+	}
+	word := filter.Normalize(strings.TrimSpace(params.Word))
+	if word == "" || strings.ContainsFunc(word, unicode.IsSpace) {
+		return healpers.Validation(validate.Errors{"word": "must be a single non-empty word"})
+	}
+	err = cfg.DB.AddBannedWord(req.Context(), word)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("add banned word: %w", err))
+	}
+	err = cfg.loadFilterWords(req.Context())
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("reload banned words: %w", err))
+	}
+	res.WriteHeader(201)
+	return nil
+}
+
+func (cfg *ApiConfig) deleteFilterWord(res http.ResponseWriter, req *http.Request) error {
+	err := cfg.requireAdmin(req)
+	if err != nil {
+		return err
+	}
+	err = cfg.DB.DeleteBannedWord(req.Context(), filter.Normalize(req.PathValue("word")))
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("delete banned word: %w", err))
+	}
+	err = cfg.loadFilterWords(req.Context())
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("reload banned words: %w", err))
+	}
+	res.WriteHeader(204)
+	return nil
+}
+
+// getFlaggedChirps lists flagged chirps, most recently flagged first. Like
+// GET /api/chirps it returns a bare array with the next page in a Link
+// header.
+func (cfg *ApiConfig) getFlaggedChirps(res http.ResponseWriter, req *http.Request) error {
+	err := cfg.requireAdmin(req)
+	if err != nil {
+		return err
+	}
+	query := req.URL.Query()
+	if query.Has("sort") {
+		return healpers.Invalid(healpers.CodeInvalidParameter, "sort is not supported; results are newest first")
+	}
+	page, err := healpers.ParsePageParams(query)
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	rows, err := cfg.DB.GetFlaggedChirps(req.Context(), database.GetFlaggedChirpsParams{
+		CursorFlaggedAt: page.CursorCreatedAt(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get flagged chirps: %w", err))
+	}
+	if len(rows) > int(page.Limit) {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		cursor := healpers.EncodeCursor(healpers.Cursor{CreatedAt: last.FlaggedAt, ID: last.ID})
+		res.Header().Set("Link", healpers.NextLink(req.URL, cursor))
+	}
+	flagged := []healpers.FlaggedChirp{}
+	for _, row := range rows {
+		flagged = append(flagged, healpers.FlaggedChirp{
+			Id:         row.ID,
+			Created_at: row.CreatedAt,
+			Body:       row.Body,
+			User_id:    row.UserID,
+			Matches:    row.Matches,
+			Flagged_at: row.FlaggedAt,
+		})
+	}
+	healpers.RespondWithJSON(res, req, 200, flagged)
+	return nil
+}
+
+// getDeletedChirps lists soft-deleted chirps that have not been purged yet,
+// most recently deleted first, paged the same way as getFlaggedChirps.
+func (cfg *ApiConfig) getDeletedChirps(res http.ResponseWriter, req *http.Request) error {
+	err := cfg.requireAdmin(req)
+	if err != nil {
+		return err
+	}
+	query := req.URL.Query()
+	if query.Has("sort") {
+		return healpers.Invalid(healpers.CodeInvalidParameter, "sort is not supported; results are newest first")
+	}
+	page, err := healpers.ParsePageParams(query)
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	chirps, err := cfg.DB.GetDeletedChirps(req.Context(), database.GetDeletedChirpsParams{
+		CursorDeletedAt: page.CursorCreatedAt(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get deleted chirps: %w", err))
+	}
+	if len(chirps) > int(page.Limit) {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		cursor := healpers.EncodeCursor(healpers.Cursor{CreatedAt: last.DeletedAt.Time, ID: last.ID})
+		res.Header().Set("Link", healpers.NextLink(req.URL, cursor))
+	}
+	deleted := []healpers.DeletedChirp{}
+	for _, chirp := range chirps {
+		deleted = append(deleted, healpers.DeletedChirp{
+			Id:         chirp.ID,
+			Created_at: chirp.CreatedAt,
+			Body:       chirp.Body,
+			User_id:    chirp.UserID,
+			Deleted_at: chirp.DeletedAt.Time,
+		})
+	}
+	healpers.RespondWithJSON(res, req, 200, deleted)
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/CookieBorn/chirpy/internal/mail"
+	"github.com/CookieBorn/chirpy/internal/validate"
+)
+
+// passwordResetSendTimeout bounds the work postForgotPassword leaves
+// running after it has answered.
+const passwordResetSendTimeout = 30 * time.Second
+
+// postForgotPassword emails a reset link. It answers 202 straight away and
+// does the lookup and sending afterwards, so neither the status nor the
+// response time tells a caller whether the email belongs to an account.
+func (cfg *ApiConfig) postForgotPassword(res http.ResponseWriter, req *http.Request) error {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		return healpers.MalformedBody(err)
+	}
+	logger := cfg.logger(req)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), passwordResetSendTimeout)
+	cfg.background.Add(1)
+	go func() {
+		defer cfg.background.Done()
+		defer cancel()
+		err := cfg.sendPasswordReset(ctx, validate.NormalizeEmail(params.Email))
+		if err != nil {
+			logger.Error("send password reset failed", "error", err)
+		}
+	}()
+	res.WriteHeader(202)
+	return nil
+}
+
+// sendPasswordReset creates a reset token for the account with email, if
+// there is one, and mails the link. Each address gets a few mails an hour
+// however many IPs ask, whether or not it has an account.
+func (cfg *ApiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	if ok, _ := cfg.ResetEmailLimiter.Allow(email); !ok {
+		return nil
+	}
+	usr, err := cfg.DB.GetUserEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	token, err := auth.MakeResetToken()
+	if err != nil {
+		return fmt.Errorf("make reset token: %w", err)
+	}
+	err = cfg.DB.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    usr.ID,
+		ExpiresAt: time.Now().Add(cfg.Config.PasswordResetLifetime),
+	})
+	if err != nil {
+		return fmt.Errorf("create password reset token: %w", err)
+	}
+	link := cfg.Config.PublicURL + "/app/reset-password?token=" + url.QueryEscape(token)
+	err = cfg.Mailer.Send(ctx, mail.Message{
+		From:    cfg.Config.MailFrom,
+		To:      usr.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Use this link within %s to choose a new one:\n%s\n\n"+
+			"If it wasn't you, ignore this email; your password has not changed.\n",
+			cfg.Config.PasswordResetLifetime, link),
+	})
+	if err != nil {
+		return fmt.Errorf("send password reset email: %w", err)
+	}
+	return nil
+}
+
+// postResetPassword sets a new password from a reset token. The token works
+// once, and every session of the account is logged out.
+func (cfg *ApiConfig) postResetPassword(res http.ResponseWriter, req *http.Request) error {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		return healpers.MalformedBody(err)
+	}
+	var errs validate.Errors
+	errs.Add("password", validate.Password(params.Password, ""))
+	if errs.Err() != nil {
+		return healpers.Validation(errs)
+	}
+	hashPass, err := auth.HashPassword(params.Password)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("hash password: %w", err))
+	}
+	usr, err := cfg.DB.ResetPassword(req.Context(), database.ResetPasswordParams{
+		TokenHash: auth.HashToken(params.Token),
+		Password:  hashPass,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return healpers.Invalid(healpers.CodeInvalidResetToken, "Invalid or expired reset token")
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("reset password: %w", err))
+	}
+	err = cfg.DB.ClearLoginFailures(req.Context(), usr.Email)
+	if err != nil {
+		cfg.logger(req).Error("clear login failures failed", "error", err)
+	}
+	cfg.logger(req).Info("password reset", "user_id", usr.ID.String())
+	res.WriteHeader(204)
+	return nil
+}
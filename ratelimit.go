@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/config"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// redCacheTTL bounds how stale a cached Chirpy Red status can be. Upgrades
+// handled by this instance take effect immediately.
+const redCacheTTL = time.Minute
+
+// RateLimitRead limits the read endpoints.
+func (cfg *ApiConfig) RateLimitRead(next http.HandlerFunc) http.HandlerFunc {
+	return cfg.rateLimit("read", cfg.Config.RateLimitRead, next)
+}
+
+// RateLimitWrite limits endpoints that create or change data.
+func (cfg *ApiConfig) RateLimitWrite(next http.HandlerFunc) http.HandlerFunc {
+	return cfg.rateLimit("write", cfg.Config.RateLimitWrite, next)
+}
+
+// middlewareRateLimitIP caps how many requests one IP can make across every
+// endpoint, before any auth runs, so bad tokens and the unauthenticated
+// routes are counted too. Routes with their own limit overwrite the
+// RateLimit-* headers with the tighter, per-route numbers.
+func (cfg *ApiConfig) middlewareRateLimitIP(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.takeRateLimit(w, r, "all:ip:"+clientIP(r), cfg.Config.RateLimitIP) {
+			// The mux never sees this request, so look up its route here for
+			// the access log and metrics.
+			_, r.Pattern = mux.Handler(r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit keys callers by user ID when an auth middleware has run before
+// it and by IP otherwise, and picks their quota by tier.
+func (cfg *ApiConfig) rateLimit(group string, quota config.Quota, next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		key, limit := group+":ip:"+clientIP(req), quota.Anonymous
+		if usrID, ok := auth.UserIDFromContext(req.Context()); ok {
+			key, limit = group+":user:"+usrID.String(), quota.User
+			if cfg.isChirpyRed(req, usrID) {
+				limit = quota.Red
+			}
+		}
+		if cfg.takeRateLimit(res, req, key, limit) {
+			next(res, req)
+		}
+	}
+}
+
+// takeRateLimit spends one request from key's per-minute budget and sets the
+// RateLimit-* headers. Once the budget is gone it writes the 429 and returns
+// false; a store failure lets the request through.
+func (cfg *ApiConfig) takeRateLimit(res http.ResponseWriter, req *http.Request, key string, limit int) bool {
+	result, err := cfg.RateLimits.Take(req.Context(), key, limit, time.Minute)
+	if err != nil {
+		cfg.logger(req).Error("rate limit store failed", "error", err)
+		return true
+	}
+	res.Header().Set("RateLimit-Policy", strconv.Itoa(limit)+";w=60")
+	res.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	res.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	res.Header().Set("RateLimit-Reset", strconv.Itoa(int(result.Reset.Round(time.Second)/time.Second)))
+	if !result.Allowed {
+		healpers.RespondWithProblem(res, req, tooManyRequests(res, result.RetryAfter, healpers.CodeRateLimited, "Rate limit exceeded"))
+		return false
+	}
+	return true
+}
+
+type redStatus struct {
+	red     bool
+	fetched time.Time
+}
+
+// redCache remembers which users have Chirpy Red so rate limiting doesn't
+// cost a query per request. Expired entries are swept out every redCacheTTL
+// so the map only holds recently active users.
+type redCache struct {
+	mu        sync.Mutex
+	users     map[uuid.UUID]redStatus
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRedCache() *redCache {
+	return &redCache{users: map[uuid.UUID]redStatus{}, now: time.Now}
+}
+
+func (c *redCache) get(usrID uuid.UUID) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if now.Sub(c.lastSweep) > redCacheTTL {
+		c.sweep(now)
+	}
+	status, ok := c.users[usrID]
+	if !ok || now.Sub(status.fetched) > redCacheTTL {
+		delete(c.users, usrID)
+		return false, false
+	}
+	return status.red, true
+}
+
+func (c *redCache) set(usrID uuid.UUID, red bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[usrID] = redStatus{red: red, fetched: c.now()}
+}
+
+func (c *redCache) sweep(now time.Time) {
+	for usrID, status := range c.users {
+		if now.Sub(status.fetched) > redCacheTTL {
+			delete(c.users, usrID)
+		}
+	}
+	c.lastSweep = now
+}
+
+func (cfg *ApiConfig) isChirpyRed(req *http.Request, usrID uuid.UUID) bool {
+	if red, ok := cfg.redUsers.get(usrID); ok {
+		return red
+	}
+	red, err := cfg.DB.GetUserIsChirpyRed(req.Context(), usrID)
+	if err != nil {
+		cfg.logger(req).Error("get chirpy red status failed", "error", err)
+		return false
+	}
+	cfg.redUsers.set(usrID, red)
+	return red
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/config"
+	"github.com/CookieBorn/chirpy/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+func TestRateLimitTiers(t *testing.T) {
+	cfg := &ApiConfig{
+		Config:     config.Config{RateLimitWrite: config.Quota{Anonymous: 1, User: 2, Red: 3}},
+		Keys:       auth.NewHMACKeySet("test_secret"),
+		Logger:     slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil)),
+		RateLimits: ratelimit.NewMemoryStore(),
+		redUsers:   newRedCache(),
+	}
+	handler := cfg.OptionalAuth(cfg.RateLimitWrite(func(w http.ResponseWriter, r *http.Request) {}))
+	plain, red := uuid.New(), uuid.New()
+	cfg.redUsers.set(plain, false)
+	cfg.redUsers.set(red, true)
+
+	allowed := func(usrID uuid.UUID) int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest("POST", "/api/chirps", nil)
+			if usrID != uuid.Nil {
+				token, _ := auth.MakeJWT(usrID, "test_secret", time.Hour)
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Header().Get("RateLimit-Limit") == "" || rec.Header().Get("RateLimit-Remaining") == "" || rec.Header().Get("RateLimit-Reset") == "" {
+				t.Errorf("Missing RateLimit headers: %v", rec.Header())
+			}
+			if rec.Code == http.StatusTooManyRequests {
+				if rec.Header().Get("Retry-After") == "" {
+					t.Error("429 without Retry-After")
+				}
+				continue
+			}
+			n++
+		}
+		return n
+	}
+	if got := allowed(uuid.Nil); got != 1 {
+		t.Errorf("Anonymous callers got %d requests, want 1", got)
+	}
+	if got := allowed(plain); got != 2 {
+		t.Errorf("Users got %d requests, want 2", got)
+	}
+	if got := allowed(red); got != 3 {
+		t.Errorf("Chirpy Red users got %d requests, want 3", got)
+	}
+}
+
+func TestRateLimitIPBeforeAuth(t *testing.T) {
+	cfg := &ApiConfig{
+		Config:     config.Config{RateLimitIP: 2},
+		Keys:       auth.NewHMACKeySet("test_secret"),
+		Logger:     slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil)),
+		RateLimits: ratelimit.NewMemoryStore(),
+		redUsers:   newRedCache(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps", cfg.RequireAuth(func(w http.ResponseWriter, r *http.Request) {}))
+	var route string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.middlewareRateLimitIP(mux).ServeHTTP(w, r)
+		route = r.Pattern
+	})
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i, code := range want {
+		req := httptest.NewRequest("POST", "/api/chirps", nil)
+		req.Header.Set("Authorization", "Bearer not-a-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Errorf("Request %d: got status %d, want %d", i, rec.Code, code)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Request %d: got RateLimit-Limit %q, want 2", i, rec.Header().Get("RateLimit-Limit"))
+		}
+		if route != "POST /api/chirps" {
+			t.Errorf("Request %d: got route %q", i, route)
+		}
+	}
+}
+
+func TestRedCacheSweepsExpiredUsers(t *testing.T) {
+	now := time.Now()
+	c := newRedCache()
+	c.now = func() time.Time { return now }
+	stale, fresh := uuid.New(), uuid.New()
+	c.set(stale, true)
+	now = now.Add(redCacheTTL)
+	c.set(fresh, false)
+	now = now.Add(time.Second)
+
+	if _, ok := c.get(fresh); !ok {
+		t.Error("Fresh entry should still be cached")
+	}
+	if _, ok := c.users[stale]; ok {
+		t.Error("Expired entry was never looked up again but should have been swept")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+)
+
+func TestRefreshDecision(t *testing.T) {
+	now := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	live := database.RefreshToken{ExpiresAt: now.Add(time.Hour)}
+	rotated := live
+	rotated.RotatedAt = sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+	revoked := live
+	revoked.RevokedAt = sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+	rotatedThenRevoked := rotated
+	rotatedThenRevoked.RevokedAt = revoked.RevokedAt
+	expired := live
+	expired.ExpiresAt = now.Add(-time.Second)
+
+	cases := []struct {
+		name      string
+		token     database.RefreshToken
+		rotateErr error
+		code      string
+		revoked   bool
+	}{
+		{name: "valid", token: live},
+		{name: "rotated", token: rotated, code: healpers.CodeTokenReused, revoked: true},
+		{name: "rotated then revoked", token: rotatedThenRevoked, code: healpers.CodeTokenReused, revoked: true},
+		{name: "revoked", token: revoked, code: healpers.CodeTokenInvalid},
+		{name: "expired", token: expired, code: healpers.CodeTokenExpired},
+		{name: "lost rotate race", token: live, rotateErr: sql.ErrNoRows, code: healpers.CodeTokenReused, revoked: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			familyRevoked := false
+			revokeFamily := func() { familyRevoked = true }
+			err := rejectRefresh(res, checkRefreshToken(c.token, now), revokeFamily)
+			if err == nil {
+				err = rejectRefresh(res, checkRotation(c.rotateErr), revokeFamily)
+			}
+			if c.code == "" {
+				if err != nil {
+					t.Fatalf("Expected the token to be accepted, got %v", err)
+				}
+			} else {
+				var appErr *healpers.AppError
+				if !errors.As(err, &appErr) {
+					t.Fatalf("Expected an AppError, got %v", err)
+				}
+				if appErr.Kind != healpers.KindUnauthorized || appErr.Code != c.code {
+					t.Errorf("Got %v %q, want unauthorized %q", appErr.Kind, appErr.Code, c.code)
+				}
+				if res.Header().Get("WWW-Authenticate") == "" {
+					t.Error("Expected a WWW-Authenticate challenge")
+				}
+			}
+			if familyRevoked != c.revoked {
+				t.Errorf("Family revoked = %v, want %v", familyRevoked, c.revoked)
+			}
+		})
+	}
+}
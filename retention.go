@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// postRestoreChirp undoes a delete, as long as the author asks within the
+// restore window and the chirp has not been purged.
+func (cfg *ApiConfig) postRestoreChirp(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	chirpID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	chirp, err := cfg.DB.GetDeletedChirp(req.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return healpers.NotFound(healpers.CodeChirpNotFound, "Chirp not found")
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get deleted chirp: %w", err))
+	}
+	if chirp.UserID != usrID {
+		return healpers.Forbidden(healpers.CodeNotAuthor, "Only the author can restore a chirp")
+	}
+	// The database checks the window against the clock that stamped
+	// deleted_at. With no window nothing can be restored.
+	if cfg.Config.ChirpRestoreWindow <= 0 {
+		return restoreWindowClosed()
+	}
+	chirp, err = cfg.DB.RestoreChirp(req.Context(), database.RestoreChirpParams{
+		ID:            chirp.ID,
+		WindowSeconds: cfg.Config.ChirpRestoreWindow.Seconds(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return restoreWindowClosed()
+	}
+	if healpers.IsUniqueViolation(err) {
+		return healpers.Conflict(healpers.CodeDuplicateChirp, "A chirp with this body already exists")
+	}
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("restore chirp: %w", err))
+	}
+	jsonChirps := healpers.Chirps{healpers.ChirpFromDB(chirp)}
+	err = cfg.decorateChirps(req.Context(), uuid.NullUUID{UUID: usrID, Valid: true}, jsonChirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	healpers.RespondWithJSON(res, req, 200, jsonChirps[0])
+	return nil
+}
+
+func restoreWindowClosed() *healpers.AppError {
+	return healpers.Forbidden(healpers.CodeRestoreWindowClosed, "This chirp can no longer be restored")
+}
+
+// purgeDeletedChirps permanently removes chirps that were deleted longer ago
+// than the retention period. It runs once at startup and then every purge
+// interval until ctx is done.
+func (cfg *ApiConfig) purgeDeletedChirps(ctx context.Context) {
+	ticker := time.NewTicker(cfg.Config.ChirpPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := cfg.DB.PurgeDeletedChirps(ctx, cfg.Config.ChirpRetention.Seconds())
+		if err != nil && ctx.Err() == nil {
+			cfg.Logger.Error("purge deleted chirps failed", "error", err)
+		}
+		if purged > 0 {
+			cfg.Logger.Info("purged deleted chirps", "count", purged, "retention", cfg.Config.ChirpRetention.String())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
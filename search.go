@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// searchChirpsHandle ranks chirps by relevance to q. Pages are keyed on
+// (rank, created_at, id) so the cursor stays stable while scrolling.
+func (cfg *ApiConfig) searchChirpsHandle(res http.ResponseWriter, req *http.Request) error {
+	query := req.URL.Query()
+	tsQuery, err := healpers.BuildTSQuery(query.Get("q"))
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	if query.Has("sort") {
+		return healpers.Invalid(healpers.CodeInvalidParameter, "sort is not supported; results are ordered by relevance")
+	}
+	page, err := healpers.ParsePageParams(query)
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	params := database.SearchChirpsParams{
+		Query:           tsQuery,
+		CursorCreatedAt: page.CursorCreatedAt(),
+		CursorRank:      page.CursorRank(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	}
+	if Aid := query.Get("author_id"); Aid != "" {
+		ID, err := uuid.Parse(Aid)
+		if err != nil {
+			return healpers.Invalid(healpers.CodeInvalidParameter, "author_id must be a UUID")
+		}
+		params.AuthorID = uuid.NullUUID{UUID: ID, Valid: true}
+	}
+	params.Since, err = parseTimeParam(query.Get("since"))
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, "since must be an RFC 3339 timestamp")
+	}
+	params.Until, err = parseTimeParam(query.Get("until"))
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, "until must be an RFC 3339 timestamp")
+	}
+	rows, err := cfg.DB.SearchChirps(req.Context(), params)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("search chirps: %w", err))
+	}
+	chirps := []database.Chirp{}
+	for _, row := range rows {
+		chirps = append(chirps, database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+		})
+	}
+	chirpPage := healpers.NewChirpPage(chirps, page.Limit)
+	if chirpPage.NextCursor != "" {
+		last := rows[page.Limit-1]
+		chirpPage.NextCursor = healpers.EncodeCursor(healpers.Cursor{
+			Rank:      last.Rank,
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		})
+	}
+	err = cfg.decorateChirps(req.Context(), viewerID(req), chirpPage.Chirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	healpers.RespondWithJSON(res, req, 200, chirpPage)
+	return nil
+}
+
+func parseTimeParam(s string) (sql.NullTime, error) {
+	if s == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// getSessions lists the caller's active logins, most recently used first.
+func (cfg *ApiConfig) getSessions(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	current, _ := auth.SessionIDFromContext(req.Context())
+	rows, err := cfg.DB.GetUserSessions(req.Context(), usrID)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get sessions: %w", err))
+	}
+	sessions := []healpers.Session{}
+	for _, row := range rows {
+		sessions = append(sessions, healpers.Session{
+			Id:           row.FamilyID,
+			User_agent:   row.UserAgent,
+			Ip:           row.Ip,
+			Created_at:   row.StartedAt,
+			Last_used_at: row.LastUsedAt,
+			Expires_at:   row.ExpiresAt,
+			Current:      row.FamilyID == current,
+		})
+	}
+	healpers.RespondWithJSON(res, req, 200, sessions)
+	return nil
+}
+
+// deleteSession logs out one session. Access tokens already issued for it
+// stop working at once, since the auth middleware checks the session.
+func (cfg *ApiConfig) deleteSession(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	sessionID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return healpers.NotFound(healpers.CodeSessionNotFound, "Session not found")
+	}
+	revoked, err := cfg.DB.RevokeSession(req.Context(), database.RevokeSessionParams{
+		UserID:   usrID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("revoke session: %w", err))
+	}
+	if revoked == 0 {
+		return healpers.NotFound(healpers.CodeSessionNotFound, "Session not found")
+	}
+	res.WriteHeader(204)
+	return nil
+}
+
+// deleteOtherSessions logs out everywhere except the session making the
+// request, access tokens included. Tokens that predate sessions have none,
+// so every session goes.
+func (cfg *ApiConfig) deleteOtherSessions(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	current, _ := auth.SessionIDFromContext(req.Context())
+	err := cfg.DB.RevokeOtherSessions(req.Context(), database.RevokeOtherSessionsParams{
+		UserID:   usrID,
+		FamilyID: current,
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("revoke sessions: %w", err))
+	}
+	res.WriteHeader(204)
+	return nil
+}
@@ -0,0 +1,4 @@
+-- name: GetChirpRevisions :many
+SELECT * from chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC;
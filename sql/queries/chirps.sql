@@ -1,27 +1,134 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
--- name: GetChirpsAll :many
+-- name: GetChirp :one
 SELECT * from chirps
-ORDER BY created_at;
+WHERE id=$1 AND deleted_at IS NULL;
 
--- name: GetChirp :one
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetDeletedChirp :one
+SELECT * from chirps
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: GetDeletedChirps :many
 SELECT * from chirps
-WHERE id=$1;
+WHERE deleted_at IS NOT NULL
+AND (sqlc.narg('cursor_deleted_at')::timestamp IS NULL
+    OR (deleted_at, id) < (sqlc.narg('cursor_deleted_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY deleted_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
 
--- name: DeleteChirp :exec
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE id = sqlc.arg('id') AND deleted_at IS NOT NULL
+  AND deleted_at >= NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8)
+RETURNING *;
+
+-- name: PurgeDeletedChirps :execrows
 DELETE from chirps
-WHERE id = $1;
+WHERE deleted_at < NOW() - make_interval(secs => sqlc.arg('retention_seconds')::float8);
+
+-- name: EditChirp :one
+-- Saves the current body as a revision and replaces it in one statement, so
+-- an edit never loses the text it overwrote. Nothing matches once the edit
+-- window has passed, and an unchanged body leaves no revision behind.
+WITH old AS (
+    SELECT id, body, updated_at from chirps
+    WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+      AND created_at >= NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8)
+    FOR UPDATE
+), revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), old.id, old.body, old.updated_at, NOW() from old
+    WHERE old.body <> sqlc.arg('body')
+)
+UPDATE chirps
+SET body = sqlc.arg('body'),
+    updated_at = CASE WHEN old.body = sqlc.arg('body') THEN chirps.updated_at ELSE NOW() END
+FROM old
+WHERE chirps.id = old.id
+RETURNING chirps.*;
 
--- name: GetChirpsAllAuthor :many
+-- name: GetChirpsPageAsc :many
 SELECT * from chirps
-WHERE user_id=$1
-ORDER BY created_at;
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at, id
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetChirpsPageDesc :many
+SELECT * from chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetReplyCounts :many
+SELECT in_reply_to, COUNT(*) AS reply_count from chirps
+WHERE in_reply_to = ANY(sqlc.arg('ids')::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at, 1 AS depth
+    FROM chirps c
+    WHERE c.id = (SELECT r.in_reply_to FROM chirps r WHERE r.id = $1)
+    AND c.deleted_at IS NULL
+    UNION ALL
+    SELECT p.id, p.created_at, p.updated_at, p.body, p.user_id, p.in_reply_to, p.deleted_at, a.depth + 1
+    FROM chirps p
+    JOIN ancestors a ON p.id = a.in_reply_to
+    WHERE p.deleted_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from ancestors
+ORDER BY depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at
+    FROM chirps c
+    WHERE c.in_reply_to = $1 AND c.deleted_at IS NULL
+    UNION ALL
+    SELECT r.id, r.created_at, r.updated_at, r.body, r.user_id, r.in_reply_to, r.deleted_at
+    FROM chirps r
+    JOIN descendants d ON r.in_reply_to = d.id
+    WHERE r.deleted_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at from descendants
+ORDER BY created_at, id;
+
+-- name: SearchChirps :many
+-- Filters on the same expression as chirps_body_search_idx so the GIN index
+-- is used, and only the matching rows are ranked.
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, rank FROM (
+    SELECT id, created_at, updated_at, body, user_id, in_reply_to,
+        ts_rank(to_tsvector('english', body), to_tsquery('english', sqlc.arg('query')))::real AS rank
+    FROM chirps
+    WHERE to_tsvector('english', body) @@ to_tsquery('english', sqlc.arg('query'))
+    AND deleted_at IS NULL
+    AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+    AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+    AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+) ranked
+WHERE (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (rank, created_at, id) < (sqlc.narg('cursor_rank')::real, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
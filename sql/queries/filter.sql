@@ -0,0 +1,39 @@
+-- name: ListBannedWords :many
+SELECT word from banned_words
+ORDER BY word;
+
+-- name: AddBannedWord :exec
+INSERT INTO banned_words (word, created_at)
+VALUES (
+    $1,
+    NOW()
+)
+ON CONFLICT (word) DO NOTHING;
+
+-- name: DeleteBannedWord :exec
+DELETE from banned_words
+WHERE word = $1;
+
+-- name: FlagChirp :exec
+INSERT INTO chirp_flags (chirp_id, matches, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (chirp_id) DO UPDATE
+SET matches = EXCLUDED.matches, created_at = EXCLUDED.created_at;
+
+-- name: UnflagChirp :exec
+DELETE from chirp_flags
+WHERE chirp_id = $1;
+
+-- name: GetFlaggedChirps :many
+SELECT chirps.*, chirp_flags.matches, chirp_flags.created_at AS flagged_at
+FROM chirp_flags
+JOIN chirps ON chirps.id = chirp_flags.chirp_id
+WHERE chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_flagged_at')::timestamp IS NULL
+    OR (chirp_flags.created_at, chirps.id) < (sqlc.narg('cursor_flagged_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirp_flags.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
@@ -0,0 +1,41 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE from follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowers :many
+SELECT users.id, users.is_chirpy_red, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = sqlc.arg('user_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, users.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY follows.created_at DESC, users.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetFollowing :many
+SELECT users.id, users.is_chirpy_red, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, users.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY follows.created_at DESC, users.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetTimeline :many
+SELECT chirps.* from chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('user_id') AND chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
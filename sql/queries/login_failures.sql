@@ -0,0 +1,33 @@
+-- name: GetLoginFailures :one
+SELECT * FROM login_failures
+WHERE email = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (email, failed_count, last_failed_at)
+VALUES (
+    sqlc.arg(email),
+    1,
+    sqlc.arg(failed_at)
+)
+ON CONFLICT (email) DO UPDATE
+SET failed_count = CASE
+        WHEN login_failures.last_failed_at < sqlc.arg(reset_before) THEN 1
+        ELSE login_failures.failed_count + 1
+    END,
+    last_failed_at = sqlc.arg(failed_at)
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_failures
+SET locked_until = $2
+WHERE email = $1;
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_failures
+WHERE email = $1;
+
+-- name: PurgeLoginFailures :execrows
+-- Forgets failures that no longer count and lockouts that have ended.
+DELETE FROM login_failures
+WHERE last_failed_at < sqlc.arg(reset_before)
+  AND (locked_until IS NULL OR locked_until < sqlc.arg(now)::timestamp);
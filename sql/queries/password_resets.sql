@@ -0,0 +1,39 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3
+);
+
+-- name: ResetPassword :one
+-- Uses up the token, sets the new password, voids the user's other reset
+-- links and revokes every refresh token in one statement, so a password is
+-- never changed while an old session or link stays alive.
+WITH consumed AS (
+    UPDATE password_reset_tokens
+    SET used_at = NOW()
+    WHERE token_hash = sqlc.arg(token_hash)
+      AND used_at IS NULL
+      AND expires_at > NOW()
+    RETURNING user_id
+), invalidated AS (
+    UPDATE password_reset_tokens
+    SET used_at = NOW()
+    FROM consumed
+    WHERE password_reset_tokens.user_id = consumed.user_id
+      AND password_reset_tokens.used_at IS NULL
+      AND password_reset_tokens.token_hash <> sqlc.arg(token_hash)
+), revoked AS (
+    UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    FROM consumed
+    WHERE refresh_tokens.user_id = consumed.user_id
+      AND refresh_tokens.revoked_at IS NULL
+)
+UPDATE users
+SET password = sqlc.arg(password), updated_at = NOW()
+FROM consumed
+WHERE users.id = consumed.user_id
+RETURNING users.id, users.email;
@@ -1,19 +1,72 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip, last_used_at)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW()
 )
 RETURNING *;
 
 -- name: GetUserFromRefreshToken :one
 Select * from refresh_tokens
-Where token=$1;
+Where token_hash=$1;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 set revoked_at = NOW(), updated_at = NOW()
-Where user_id=$1;
+Where token_hash=$1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+set revoked_at = NOW(), updated_at = NOW()
+Where family_id=$1 AND revoked_at IS NULL;
+
+-- name: RotateRefreshToken :one
+WITH rotated AS (
+    UPDATE refresh_tokens
+    SET rotated_at = NOW(), updated_at = NOW()
+    WHERE refresh_tokens.token_hash = sqlc.arg(old_token_hash)
+      AND rotated_at IS NULL
+      AND revoked_at IS NULL
+    RETURNING user_id, family_id
+)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip, last_used_at)
+SELECT sqlc.arg(new_token_hash), NOW(), NOW(), rotated.user_id, sqlc.arg(expires_at), rotated.family_id, sqlc.arg(user_agent), sqlc.arg(ip), NOW()
+FROM rotated
+RETURNING *;
+
+-- name: GetUserSessions :many
+SELECT refresh_tokens.family_id, refresh_tokens.user_agent, refresh_tokens.ip, refresh_tokens.last_used_at, refresh_tokens.expires_at,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::timestamp AS started_at
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
+  AND refresh_tokens.rotated_at IS NULL
+  AND refresh_tokens.revoked_at IS NULL
+  AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
+
+-- name: IsSessionActive :one
+-- A session is live while its family still has an unrotated, unrevoked
+-- refresh token. Logging out or revoking the session ends it.
+SELECT EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE family_id = $1
+      AND rotated_at IS NULL
+      AND revoked_at IS NULL
+);
@@ -0,0 +1,44 @@
+-- name: AddChirpTags :exec
+INSERT INTO chirp_tags (chirp_id, tag, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, unnest(sqlc.arg('tags')::text[]), sqlc.arg('created_at')::timestamp
+ON CONFLICT DO NOTHING;
+
+-- name: AddChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id)
+SELECT sqlc.arg('chirp_id')::uuid, id from users
+WHERE email = ANY(sqlc.arg('emails')::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpTags :exec
+DELETE from chirp_tags
+WHERE chirp_id = $1;
+
+-- name: DeleteChirpMentions :exec
+DELETE from chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetChirpsByTag :many
+SELECT chirps.* from chirps
+JOIN chirp_tags ON chirp_tags.chirp_id = chirps.id
+WHERE chirp_tags.tag = sqlc.arg('tag') AND chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetMentionChirps :many
+SELECT chirps.* from chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = sqlc.arg('user_id') AND chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetTrendingTags :many
+SELECT tag, COUNT(*) AS chirp_count from chirp_tags
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE chirp_tags.created_at >= sqlc.arg('since') AND chirps.deleted_at IS NULL
+GROUP BY tag
+ORDER BY chirp_count DESC, tag
+LIMIT sqlc.arg('tag_limit');
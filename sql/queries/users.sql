@@ -16,16 +16,38 @@ DELETE from users;
 SELECT * from users
 where email=$1;
 
--- name: UpdateUserEmailPassword :exec
-UPDATE users
-set email = $1, updated_at = NOW(), password = $2
-Where id=$3;
-
 -- name: GetUserEmailFromID :one
 SELECT email from users
 where id=$1;
 
--- name: SetUserToRed :exec
+-- name: SetUserToRed :execrows
 UPDATE users
 set is_chirpy_red = true
 Where id=$1;
+
+-- name: GetUserIsChirpyRed :one
+SELECT is_chirpy_red from users
+where id=$1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+set password = $2, updated_at = NOW()
+Where id=$1;
+
+-- name: GetUserVerification :one
+SELECT email, pending_email, email_verified_at from users
+where id=$1;
+
+-- name: SetUserPendingEmail :exec
+UPDATE users
+set pending_email = $2, updated_at = NOW()
+Where id=$1;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users
+set email = sqlc.arg('email'),
+    pending_email = NULLIF(pending_email, sqlc.arg('email')),
+    email_verified_at = sqlc.arg('verified_at')::timestamp,
+    updated_at = NOW()
+Where id = sqlc.arg('id')
+AND (email = sqlc.arg('email') OR pending_email = sqlc.arg('email'));
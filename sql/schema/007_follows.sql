@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE follows (
+    follower_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    followee_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+CREATE INDEX follows_followee_id_created_at_idx ON follows (followee_id, created_at);
+
+-- +goose Down
+DROP TABLE follows;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE banned_words (
+    word TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL
+);
+INSERT INTO banned_words (word, created_at)
+VALUES ('kerfuffle', NOW()), ('sharbert', NOW()), ('fornax', NOW());
+
+CREATE TABLE chirp_flags (
+    chirp_id uuid PRIMARY KEY REFERENCES chirps (id) ON DELETE CASCADE,
+    matches TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE chirp_flags;
+DROP TABLE banned_words;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+    ADD COLUMN family_id uuid NOT NULL DEFAULT gen_random_uuid(),
+    ADD COLUMN rotated_at TIMESTAMP;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id DROP DEFAULT;
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_family_id_idx;
+ALTER TABLE refresh_tokens
+    DROP COLUMN rotated_at,
+    DROP COLUMN family_id;
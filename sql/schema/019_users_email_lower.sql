@@ -0,0 +1,10 @@
+-- +goose Up
+-- Emails are stored case-folded from now on. If two accounts differ only
+-- in case this fails, and they have to be merged by hand first.
+UPDATE users
+SET email = lower(email), pending_email = lower(pending_email)
+WHERE email <> lower(email) OR pending_email <> lower(pending_email);
+
+-- +goose Down
+-- The original case is gone; nothing to undo.
+SELECT 1;
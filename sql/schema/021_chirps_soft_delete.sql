@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN deleted_at TIMESTAMP;
+CREATE INDEX chirps_deleted_at_idx ON chirps (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- A deleted chirp no longer holds on to its body, so it can be posted again.
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_body_key;
+CREATE UNIQUE INDEX chirps_body_live_idx ON chirps (body) WHERE deleted_at IS NULL;
+
+-- +goose Down
+-- Chirps waiting to be purged are dropped now, since their bodies may clash
+-- with live ones once the constraint is back.
+DELETE FROM chirps
+WHERE deleted_at IS NOT NULL;
+DROP INDEX chirps_body_live_idx;
+ALTER TABLE chirps
+ADD CONSTRAINT chirps_body_key UNIQUE (body);
+DROP INDEX chirps_deleted_at_idx;
+ALTER TABLE chirps
+DROP COLUMN deleted_at;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- Failures are counted per normalized email, whether or not it has an
+-- account, so a lockout doesn't reveal which emails are registered.
+-- Current counts and lockouts are dropped.
+DROP TABLE login_failures;
+CREATE TABLE login_failures (
+    email TEXT PRIMARY KEY,
+    failed_count INTEGER NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_failures;
+CREATE TABLE login_failures (
+    user_id uuid PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    failed_count INTEGER NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
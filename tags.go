@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CookieBorn/chirpy/internal/auth"
+	"github.com/CookieBorn/chirpy/internal/database"
+	healpers "github.com/CookieBorn/chirpy/internal/helpers"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 30 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+)
+
+// indexChirpEntities stores the hashtags and mentions found in a new chirp.
+func (cfg *ApiConfig) indexChirpEntities(ctx context.Context, chirp database.Chirp) error {
+	tags := healpers.ExtractHashtags(chirp.Body)
+	if len(tags) > 0 {
+		err := cfg.DB.AddChirpTags(ctx, database.AddChirpTagsParams{
+			ChirpID:   chirp.ID,
+			Tags:      tags,
+			CreatedAt: chirp.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	mentions := healpers.ExtractMentions(chirp.Body)
+	if len(mentions) > 0 {
+		err := cfg.DB.AddChirpMentions(ctx, database.AddChirpMentionsParams{
+			ChirpID: chirp.ID,
+			Emails:  mentions,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reindexChirpEntities replaces the hashtags and mentions stored for an
+// edited chirp with the ones in its new body.
+func (cfg *ApiConfig) reindexChirpEntities(ctx context.Context, chirp database.Chirp) error {
+	err := cfg.DB.DeleteChirpTags(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+	err = cfg.DB.DeleteChirpMentions(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+	return cfg.indexChirpEntities(ctx, chirp)
+}
+
+func (cfg *ApiConfig) getTagChirps(res http.ResponseWriter, req *http.Request) error {
+	tag := strings.ToLower(strings.TrimPrefix(req.PathValue("tag"), "#"))
+	if tag == "" {
+		return healpers.NotFound(healpers.CodeNotFound, "Tag not found")
+	}
+	page, err := healpers.ParsePageParams(req.URL.Query())
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	chirps, err := cfg.DB.GetChirpsByTag(req.Context(), database.GetChirpsByTagParams{
+		Tag:             tag,
+		CursorCreatedAt: page.CursorCreatedAt(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get tag chirps: %w", err))
+	}
+	chirpPage := healpers.NewChirpPage(chirps, page.Limit)
+	err = cfg.decorateChirps(req.Context(), viewerID(req), chirpPage.Chirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	healpers.RespondWithJSON(res, req, 200, chirpPage)
+	return nil
+}
+
+// getTrendingTags ranks tags by how many chirps used them within the
+// window, e.g. ?window=6h. The window defaults to a day.
+func (cfg *ApiConfig) getTrendingTags(res http.ResponseWriter, req *http.Request) error {
+	window := defaultTrendingWindow
+	if w := req.URL.Query().Get("window"); w != "" {
+		parsed, err := time.ParseDuration(w)
+		if err != nil || parsed <= 0 || parsed > maxTrendingWindow {
+			return healpers.Invalid(healpers.CodeInvalidParameter, "window must be a positive duration of at most 720h")
+		}
+		window = parsed
+	}
+	limit := defaultTrendingLimit
+	if l := req.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 {
+			return healpers.Invalid(healpers.CodeInvalidParameter, "limit must be a positive integer")
+		}
+		limit = min(parsed, healpers.MaxPageLimit)
+	}
+	rows, err := cfg.DB.GetTrendingTags(req.Context(), database.GetTrendingTagsParams{
+		Since:    time.Now().UTC().Add(-window),
+		TagLimit: int32(limit),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get trending tags: %w", err))
+	}
+	trending := healpers.TrendingTags{Window: window.String(), Tags: []healpers.TrendingTag{}}
+	for _, row := range rows {
+		trending.Tags = append(trending.Tags, healpers.TrendingTag{
+			Tag:         row.Tag,
+			Chirp_count: row.ChirpCount,
+		})
+	}
+	healpers.RespondWithJSON(res, req, 200, trending)
+	return nil
+}
+
+func (cfg *ApiConfig) getMyMentions(res http.ResponseWriter, req *http.Request) error {
+	usrID, _ := auth.UserIDFromContext(req.Context())
+	page, err := healpers.ParsePageParams(req.URL.Query())
+	if err != nil {
+		return healpers.Invalid(healpers.CodeInvalidParameter, err.Error())
+	}
+	chirps, err := cfg.DB.GetMentionChirps(req.Context(), database.GetMentionChirpsParams{
+		UserID:          usrID,
+		CursorCreatedAt: page.CursorCreatedAt(),
+		CursorID:        page.CursorID(),
+		PageLimit:       page.FetchLimit(),
+	})
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("get mentions: %w", err))
+	}
+	chirpPage := healpers.NewChirpPage(chirps, page.Limit)
+	err = cfg.decorateChirps(req.Context(), uuid.NullUUID{UUID: usrID, Valid: true}, chirpPage.Chirps)
+	if err != nil {
+		return healpers.Internal(fmt.Errorf("decorate chirps: %w", err))
+	}
+	healpers.RespondWithJSON(res, req, 200, chirpPage)
+	return nil
+}